@@ -11,12 +11,15 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"math"
 	"mime"
+	"net"
 	"net/http"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"runtime/debug"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -25,7 +28,9 @@ import (
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-lambda-go/lambdacontext"
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/service/dynamodb"
 	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
 	sdkLambda "github.com/aws/aws-sdk-go/service/lambda"
@@ -34,6 +39,7 @@ import (
 	uuid "github.com/gofrs/uuid"
 	"github.com/nathants/aws-rce/rce"
 	"github.com/nathants/libaws/lib"
+	"golang.org/x/sys/unix"
 )
 
 func index() events.APIGatewayProxyResponse {
@@ -96,11 +102,36 @@ func last(xs []string) string {
 	return xs[len(xs)-1]
 }
 
-func notfound() events.APIGatewayProxyResponse {
+func notfound(ctx context.Context) events.APIGatewayProxyResponse {
+	return errorResponse(ctx, 404, rce.CodeNotFound, "not found")
+}
+
+// every api error has the same json body. the request id is the lambda
+// request id, which is also in the server log line for the request.
+func errorResponse(ctx context.Context, statusCode int, code, message string) events.APIGatewayProxyResponse {
+	data, err := json.Marshal(rce.ErrorResponse{
+		Code:      code,
+		Message:   message,
+		RequestId: requestId(ctx),
+	})
+	if err != nil {
+		panic(err)
+	}
 	return events.APIGatewayProxyResponse{
-		Body:       "404",
-		StatusCode: 404,
+		StatusCode: statusCode,
+		Body:       string(data),
+		Headers: map[string]string{
+			"Content-Type": "application/json",
+		},
+	}
+}
+
+func requestId(ctx context.Context) string {
+	lc, ok := lambdacontext.FromContext(ctx)
+	if !ok {
+		return "-"
 	}
+	return lc.AwsRequestID
 }
 
 func checkAuth(ctx context.Context, auth string) (string, bool) {
@@ -140,85 +171,360 @@ func checkAuth(ctx context.Context, auth string) (string, bool) {
 
 func httpExecGet(ctx context.Context, event *events.APIGatewayProxyRequest, res chan<- events.APIGatewayProxyResponse, authName string) {
 	bucket := os.Getenv("PROJECT_BUCKET")
-	getRequest := rce.ExecGetRequest{
-		Uid:        event.QueryStringParameters["uid"],
-		RangeStart: atoi(event.QueryStringParameters["range-start"]),
+	getRequest, err := rce.ParseExecGetRequest(event.QueryStringParameters)
+	if err != nil {
+		res <- badRequest(ctx, err)
+		return
+	}
+	// callers that send wait, even zero, get small logs inline
+	longPoll := getRequest.Wait != nil
+	wait := 0
+	if longPoll {
+		wait = *getRequest.Wait
 	}
 	headers := map[string]string{
 		"auth-name":    authName,
 		"uid":          getRequest.Uid,
 		"Content-Type": "application/json",
 	}
-	sizeKey := fmt.Sprintf("jobs/%s/%s/size", authName, getRequest.Uid)
-	exitKey := fmt.Sprintf("jobs/%s/%s/exit", authName, getRequest.Uid)
-	logKey := fmt.Sprintf("jobs/%s/%s/log.txt", authName, getRequest.Uid)
-	// once size is known and client has read size bytes, return exit
-	outSize, err := lib.S3Client().GetObjectWithContext(ctx, &s3.GetObjectInput{
-		Bucket: aws.String(bucket),
-		Key:    aws.String(sizeKey),
-	})
-	if err == nil {
-		sizeData, err := io.ReadAll(outSize.Body)
-		if err != nil {
-			panic(err)
+	deadline := time.Now().Add(time.Duration(wait) * time.Second)
+	getResponse := rce.ExecGetResponse{}
+	for {
+		// once size is known and client has read size bytes, return exit
+		exit := jobExit(ctx, bucket, authName, getRequest.Uid, getRequest.RangeStart)
+		if exit != nil {
+			getResponse.Exit = aws.Int(exit.Exit)
+			getResponse.Signal = exit.Signal
+			getResponse.Reason = exit.Reason
+			break
 		}
-		err = outSize.Body.Close()
+		// otherwize return the log past range-start, either inline or as
+		// presigned s3 urls for the chunks covering it
+		objects, err := logObjects(ctx, bucket, authName, getRequest.Uid, getRequest.RangeStart)
 		if err != nil {
 			panic(err)
 		}
-		size := atoi(string(sizeData))
-		if getRequest.RangeStart == size {
-			outExit, err := lib.S3Client().GetObjectWithContext(ctx, &s3.GetObjectInput{
-				Bucket: aws.String(bucket),
-				Key:    aws.String(exitKey),
-			})
-			if err != nil {
-				panic(err)
-			}
-			exitData, err := io.ReadAll(outExit.Body)
-			if err != nil {
-				panic(err)
-			}
-			err = outExit.Body.Close()
-			if err != nil {
-				panic(err)
-			}
-			exit := atoi(string(exitData))
-			respData, err := json.Marshal(rce.ExecGetResponse{
-				Exit: aws.Int(exit),
-			})
-			if err != nil {
-				panic(err)
+		if len(objects) > 0 {
+			total := 0
+			for _, obj := range objects {
+				total += obj.size
 			}
-			res <- events.APIGatewayProxyResponse{
-				StatusCode: 200,
-				Body:       string(respData),
-				Headers:    headers,
+			if longPoll && total <= rce.MaxInlineLogBytes {
+				getResponse.Data = getLogObjects(ctx, bucket, objects)
+			} else {
+				getResponse.Chunks = presignLogObjects(bucket, objects)
 			}
-			return
+			break
+		}
+		if time.Now().Add(rce.LongPollInterval).After(deadline) {
+			getResponse.Chunks = []rce.LogChunk{}
+			break
 		}
+		time.Sleep(rce.LongPollInterval)
+	}
+	respData, err := json.Marshal(getResponse)
+	if err != nil {
+		panic(err)
+	}
+	res <- events.APIGatewayProxyResponse{
+		StatusCode: 200,
+		Body:       string(respData),
+		Headers:    headers,
+	}
+}
+
+// returns nil until the log is complete and the caller has read all of it
+func jobExit(ctx context.Context, bucket, authName, uid string, rangeStart int) *rce.ExitStatus {
+	sizeKey := fmt.Sprintf("jobs/%s/%s/size", authName, uid)
+	exitKey := fmt.Sprintf("jobs/%s/%s/exit", authName, uid)
+	outSize, err := lib.S3Client().GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(sizeKey),
+	})
+	if err != nil {
+		return nil
+	}
+	sizeData, err := io.ReadAll(outSize.Body)
+	if err != nil {
+		panic(err)
+	}
+	err = outSize.Body.Close()
+	if err != nil {
+		panic(err)
+	}
+	if rangeStart != atoi(string(sizeData)) {
+		return nil
 	}
-	// otherwize return presigned s3 url for range-start
-	rangeHeader := fmt.Sprintf("bytes=%d-", getRequest.RangeStart)
-	req, _ := lib.S3Client().GetObjectRequest(&s3.GetObjectInput{
+	outExit, err := lib.S3Client().GetObjectWithContext(ctx, &s3.GetObjectInput{
 		Bucket: aws.String(bucket),
-		Key:    aws.String(logKey),
-		Range:  aws.String(rangeHeader),
+		Key:    aws.String(exitKey),
 	})
-	url, err := req.Presign(60 * time.Second)
 	if err != nil {
 		panic(err)
 	}
-	respData, err := json.Marshal(rce.ExecGetResponse{
-		Url: url,
+	exitData, err := io.ReadAll(outExit.Body)
+	if err != nil {
+		panic(err)
+	}
+	err = outExit.Body.Close()
+	if err != nil {
+		panic(err)
+	}
+	exit := &rce.ExitStatus{}
+	err = json.Unmarshal(exitData, exit)
+	if err != nil {
+		panic(err)
+	}
+	return exit
+}
+
+// a log chunk in s3 from skip bytes until its end, which is size bytes
+type logObject struct {
+	key  string
+	skip int
+	size int
+}
+
+func (o logObject) byterange() string {
+	if o.skip == 0 {
+		return ""
+	}
+	return fmt.Sprintf("bytes=%d-", o.skip)
+}
+
+// map a range-start to the log chunks that cover it. the first chunk
+// is skipped into if range-start falls inside it.
+func logObjects(ctx context.Context, bucket, authName, uid string, rangeStart int) ([]logObject, error) {
+	var objects []logObject
+	offset := 0
+	err := lib.S3Client().ListObjectsV2PagesWithContext(ctx, &s3.ListObjectsV2Input{
+		Bucket: aws.String(bucket),
+		Prefix: aws.String(fmt.Sprintf("jobs/%s/%s/log/", authName, uid)),
+	}, func(page *s3.ListObjectsV2Output, _ bool) bool {
+		for _, obj := range page.Contents {
+			size := int(*obj.Size)
+			if rangeStart < offset+size {
+				skip := 0
+				if rangeStart > offset {
+					skip = rangeStart - offset
+				}
+				objects = append(objects, logObject{
+					key:  *obj.Key,
+					skip: skip,
+					size: size - skip,
+				})
+				if len(objects) == rce.MaxLogChunksGet {
+					return false
+				}
+			}
+			offset += size
+		}
+		return true
+	})
+	return objects, err
+}
+
+func presignLogObjects(bucket string, objects []logObject) []rce.LogChunk {
+	chunks := []rce.LogChunk{}
+	for _, obj := range objects {
+		chunks = append(chunks, rce.LogChunk{
+			Url:   lib.S3PresignGet(bucket, obj.key, obj.byterange(), 60*time.Second),
+			Range: obj.byterange(),
+		})
+	}
+	return chunks
+}
+
+func getLogObjects(ctx context.Context, bucket string, objects []logObject) []byte {
+	var data []byte
+	for _, obj := range objects {
+		data = append(data, getLogObject(ctx, bucket, obj, obj.size)...)
+	}
+	return data
+}
+
+// get up to limit bytes of a log chunk, starting from its skip
+func getLogObject(ctx context.Context, bucket string, obj logObject, limit int) []byte {
+	input := &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(obj.key),
+	}
+	if obj.skip != 0 || limit < obj.size {
+		input.Range = aws.String(fmt.Sprintf("bytes=%d-%d", obj.skip, obj.skip+limit-1))
+	}
+	var data []byte
+	err := lib.Retry(ctx, func() error {
+		out, err := lib.S3Client().GetObjectWithContext(ctx, input)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = out.Body.Close() }()
+		data, err = io.ReadAll(out.Body)
+		return err
 	})
 	if err != nil {
 		panic(err)
 	}
+	return data
+}
+
+func minInt(vals ...int) int {
+	result := vals[0]
+	for _, val := range vals[1:] {
+		if val < result {
+			result = val
+		}
+	}
+	return result
+}
+
+// log, state changes, and exit as server-sent events, see rce.StreamEventLog
+func httpExecStreamGet(ctx context.Context, event *events.APIGatewayProxyRequest, res chan<- events.APIGatewayProxyResponse, authName string) {
+	bucket := os.Getenv("PROJECT_BUCKET")
+	uid := event.QueryStringParameters["uid"]
+	err := rce.ValidateUid(uid)
+	if err != nil {
+		res <- badRequest(ctx, err)
+		return
+	}
+	// rangeStart is always at a frame boundary, and sent is how much of
+	// that frame's data was already sent
+	rangeStart := 0
+	sent := 0
+	lastEventId, ok := rce.CaseInsensitiveGet(event.Headers, "Last-Event-ID")
+	if !ok {
+		lastEventId, ok = event.QueryStringParameters["range-start"]
+	}
+	if ok {
+		rangeStart, sent, err = rce.ParseStreamEventId(lastEventId)
+		if err != nil {
+			res <- badRequest(ctx, fmt.Errorf("bad last-event-id: %s", lastEventId))
+			return
+		}
+	}
+	record, err := getJobRecord(ctx, uid)
+	if err != nil {
+		panic(err)
+	}
+	if record == nil || record.AuthName != authName {
+		res <- notfound(ctx)
+		return
+	}
+	var body bytes.Buffer
+	_, _ = fmt.Fprintf(&body, "retry: %d\n\n", rce.StreamRetry)
+	emit := func(eventType string, val interface{}) {
+		data, err := json.Marshal(val)
+		if err != nil {
+			panic(err)
+		}
+		err = rce.EncodeStreamEvent(&body, rce.StreamEvent{
+			Id:    rce.StreamEventId(rangeStart, sent),
+			Event: eventType,
+			Data:  data,
+		})
+		if err != nil {
+			panic(err)
+		}
+	}
+	state := record.State
+	emit(rce.StreamEventState, record.Status())
+	// pending starts at the frame header at rangeStart, or once the
+	// header is read, at data byte consumed of that frame
+	readStart := rangeStart
+	var pending []byte
+	inFrame := false
+	stream, size, headerSize, consumed := 0, 0, 0, 0
+	deadline := time.Now().Add(rce.MaxLongPollWait * time.Second)
+loop:
+	for time.Now().Before(deadline) {
+		exit := jobExit(ctx, bucket, authName, uid, readStart)
+		if exit != nil {
+			emit(rce.StreamEventExit, exit)
+			break
+		}
+		objects, err := logObjects(ctx, bucket, authName, uid, readStart)
+		if err != nil {
+			panic(err)
+		}
+		if len(objects) > 0 {
+			limit := rce.MaxStreamBytes
+			if objects[0].size < limit {
+				limit = objects[0].size
+			}
+			data := getLogObject(ctx, bucket, objects[0], limit)
+			readStart += len(data)
+			pending = append(pending, data...)
+			for {
+				if !inFrame {
+					newline := bytes.IndexByte(pending, '\n')
+					if newline == -1 {
+						break
+					}
+					stream, size, err = rce.DecodeFrameHeader(pending[:newline])
+					if err != nil {
+						panic(err)
+					}
+					pending = pending[newline+1:]
+					headerSize = newline + 1
+					consumed = 0
+					inFrame = true
+				}
+				// data sent before a reconnect
+				if consumed < sent {
+					n := minInt(sent-consumed, len(pending))
+					pending = pending[n:]
+					consumed += n
+					if consumed < sent {
+						break
+					}
+				}
+				// base64 grows data by a third, leave room for the rest of the event
+				room := (rce.MaxStreamBytes-body.Len())*3/4 - 256
+				n := minInt(size-consumed, len(pending), room)
+				if n <= 0 && size > consumed {
+					if room <= 0 {
+						break loop
+					}
+					break
+				}
+				data := pending[:n]
+				pending = pending[n:]
+				consumed += n
+				sent += n
+				if consumed == size {
+					rangeStart += headerSize + size
+					sent = 0
+					inFrame = false
+				}
+				emit(rce.StreamEventLog, rce.StreamLog{
+					Stream: stream,
+					Data:   data,
+				})
+			}
+			continue
+		}
+		record, err := getJobRecord(ctx, uid)
+		if err != nil {
+			panic(err)
+		}
+		if record != nil && record.State != state {
+			state = record.State
+			emit(rce.StreamEventState, record.Status())
+		}
+		if time.Now().Add(rce.LongPollInterval).After(deadline) {
+			break
+		}
+		time.Sleep(rce.LongPollInterval)
+	}
 	res <- events.APIGatewayProxyResponse{
 		StatusCode: 200,
-		Body:       string(respData),
-		Headers:    headers,
+		Body:       body.String(),
+		Headers: map[string]string{
+			"auth-name":     authName,
+			"uid":           uid,
+			"Content-Type":  "text/event-stream",
+			"Cache-Control": "no-cache",
+		},
 	}
 }
 
@@ -231,25 +537,127 @@ func httpExecPost(ctx context.Context, event *events.APIGatewayProxyRequest, res
 		}
 		event.Body = string(data)
 	}
+	if len(event.Body) > rce.MaxExecPostBytes {
+		res <- badRequest(ctx, fmt.Errorf("body is %d bytes, more than %d", len(event.Body), rce.MaxExecPostBytes))
+		return
+	}
 	err := json.Unmarshal([]byte(event.Body), &postReqest)
 	if err != nil {
-		panic(fmt.Sprint(event.Body, err))
+		res <- badRequest(ctx, fmt.Errorf("bad json: %w", err))
+		return
+	}
+	err = postReqest.Validate()
+	if err != nil {
+		res <- badRequest(ctx, err)
+		return
 	}
-	uid := fmt.Sprintf("%d.%s", time.Now().Unix(), uuid.Must(uuid.NewV4()).String())
-	data, err := json.Marshal(rce.ExecAsyncEvent{
-		EventType: rce.EventExec,
-		Uid:       uid,
-		AuthName:  authName,
-		Argv:      postReqest.Argv,
-		PushUrls:  postReqest.PushUrls,
+	uid := newUid()
+	ip := event.RequestContext.Identity.SourceIP
+	idempotencyKey, ok := rce.CaseInsensitiveGet(event.Headers, rce.IdempotencyKeyHeader)
+	if !ok {
+		submitJob(ctx, authName, ip, uid, "", "", &postReqest)
+		execPostRespond(res, authName, uid, false)
+		return
+	}
+	err = rce.ValidateIdempotencyKey(idempotencyKey)
+	if err != nil {
+		res <- badRequest(ctx, err)
+		return
+	}
+	existingUid, claimed, err := claimIdempotencyKey(ctx, authName, idempotencyKey, rce.Blake2b32(event.Body), uid)
+	if err != nil {
+		res <- idempotencyError(ctx, err)
+		return
+	}
+	if claimed == 0 {
+		execPostRespond(res, authName, existingUid, true)
+		return
+	}
+	replayed := existingUid != uid
+	if replayed {
+		// the first request failed partway, finish submitting under its uid
+		uid = existingUid
+		resubmitJob(ctx, authName, ip, uid, "", "", &postReqest)
+	} else {
+		submitJob(ctx, authName, ip, uid, "", "", &postReqest)
+	}
+	submittedIdempotencyKey(ctx, authName, idempotencyKey, claimed)
+	execPostRespond(res, authName, uid, replayed)
+}
+
+// write the job record then invoke the async lambda to run it
+func submitJob(ctx context.Context, authName, ip, uid, group, schedule string, postRequest *rce.ExecPostRequest) {
+	bucket := os.Getenv("PROJECT_BUCKET")
+	asyncEvent := jobEvent(ctx, authName, uid, postRequest)
+	now := time.Now()
+	putJobRecord(ctx, &rce.JobRecord{
+		RecordKey: rce.RecordKey{
+			ID: rce.JobRecordID(uid),
+		},
+		JobRecordData: rce.JobRecordData{
+			AuthName:  authName,
+			Ip:        ip,
+			State:     rce.StateSubmitted,
+			Argv:      postRequest.Argv,
+			Submitted: now.UnixNano() / 1e6,
+			Prefix:    fmt.Sprintf("s3://%s/jobs/%s/%s/", bucket, authName, uid),
+			Ttl:       now.Add(time.Duration(jobTtlDays()) * 24 * time.Hour).Unix(),
+			Group:     group,
+			Schedule:  schedule,
+			Active:    rce.ActiveShard,
+			Heartbeat: now.UnixNano() / 1e6,
+			Webhook:   asyncEvent.Webhook,
+		},
 	})
+	invokeJob(ctx, asyncEvent)
+}
+
+// finish a submission that failed partway. the job is invoked again
+// unless it started, and if the first invoke went through too, only one
+// of them runs it, see startJobRecord.
+func resubmitJob(ctx context.Context, authName, ip, uid, group, schedule string, postRequest *rce.ExecPostRequest) {
+	record, err := getJobRecord(ctx, uid)
 	if err != nil {
 		panic(err)
 	}
-	headers := map[string]string{
-		"auth-name":    authName,
-		"uid":          uid,
-		"Content-Type": "application/json",
+	if record == nil {
+		submitJob(ctx, authName, ip, uid, group, schedule, postRequest)
+		return
+	}
+	if record.State == rce.StateSubmitted {
+		invokeJob(ctx, jobEvent(ctx, authName, uid, postRequest))
+	}
+}
+
+func jobEvent(ctx context.Context, authName, uid string, postRequest *rce.ExecPostRequest) *rce.ExecAsyncEvent {
+	webhook := postRequest.Webhook
+	if webhook == "" {
+		webhook = getDefaultWebhook(ctx, authName)
+	}
+	return &rce.ExecAsyncEvent{
+		EventType:   rce.EventExec,
+		Uid:         uid,
+		AuthName:    authName,
+		Argv:        postRequest.Argv,
+		PushUrls:    postRequest.PushUrls,
+		Stdin:       postRequest.Stdin,
+		StdinUpload: postRequest.StdinUpload,
+		Env:         postRequest.Env,
+		Dir:         postRequest.Dir,
+		CleanEnv:    postRequest.CleanEnv,
+		Workspace:   postRequest.Workspace,
+		Artifacts:   postRequest.Artifacts,
+		Raw:         postRequest.Raw,
+		Timeout:     postRequest.Timeout,
+		Webhook:     webhook,
+	}
+}
+
+// invoke the async lambda to run a job
+func invokeJob(ctx context.Context, asyncEvent *rce.ExecAsyncEvent) {
+	data, err := json.Marshal(asyncEvent)
+	if err != nil {
+		panic(err)
 	}
 	err = lib.Retry(ctx, func() error {
 		out, err := lib.LambdaClient().InvokeWithContext(ctx, &sdkLambda.InvokeInput{
@@ -269,12 +677,27 @@ func httpExecPost(ctx context.Context, event *events.APIGatewayProxyRequest, res
 	if err != nil {
 		panic(err)
 	}
-	data, err = json.Marshal(rce.ExecPostResponse{
+}
+
+func newUid() string {
+	return fmt.Sprintf("%d.%s", time.Now().Unix(), uuid.Must(uuid.NewV4()).String())
+}
+
+func execPostRespond(res chan<- events.APIGatewayProxyResponse, authName, uid string, replayed bool) {
+	data, err := json.Marshal(rce.ExecPostResponse{
 		Uid: uid,
 	})
 	if err != nil {
 		panic(err)
 	}
+	headers := map[string]string{
+		"auth-name":    authName,
+		"uid":          uid,
+		"Content-Type": "application/json",
+	}
+	if replayed {
+		headers[rce.IdempotentReplayedHeader] = "true"
+	}
 	res <- events.APIGatewayProxyResponse{
 		StatusCode: 200,
 		Body:       string(data),
@@ -282,38 +705,1985 @@ func httpExecPost(ctx context.Context, event *events.APIGatewayProxyRequest, res
 	}
 }
 
-func httpVersionGet(_ context.Context, _ *events.APIGatewayProxyRequest, res chan<- events.APIGatewayProxyResponse) {
-	val := map[string]string{}
-	err := filepath.Walk(".", func(file string, _ os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-		info, err := os.Stat(file)
-		if err != nil {
-			panic(err)
-		}
-		if info.IsDir() {
-			return nil
-		}
-		data, err := os.ReadFile(file)
+var errIdempotencyInProgress = fmt.Errorf("a request with this %s is in progress, retry later", rce.IdempotencyKeyHeader)
+
+func idempotencyError(ctx context.Context, err error) events.APIGatewayProxyResponse {
+	if err == errIdempotencyInProgress {
+		return errorResponse(ctx, 409, rce.CodeConflict, err.Error())
+	}
+	return badRequest(ctx, err)
+}
+
+// claim the idempotency key for id, returning id and the claim, which
+// is passed to submittedIdempotencyKey once the request is done. if an
+// earlier request already submitted, its id is returned with a zero
+// claim, to be replayed. if an earlier request claimed the key but
+// stopped responding for IdempotencyClaimTimeout, the claim is taken
+// over and its id is returned, to finish submitting. if it is still
+// within the timeout, the error is errIdempotencyInProgress. a key
+// reused with a different request body is an error.
+func claimIdempotencyKey(ctx context.Context, authName, key, requestHash, id string) (string, int64, error) {
+	recordId := rce.IdempotencyRecordID(authName, key)
+	now := time.Now().UnixNano() / 1e6
+	item, err := dynamodbattribute.MarshalMap(rce.IdempotencyRecord{
+		RecordKey: rce.RecordKey{
+			ID: recordId,
+		},
+		IdempotencyRecordData: rce.IdempotencyRecordData{
+			Uid:         id,
+			RequestHash: requestHash,
+			State:       rce.IdempotencyClaimed,
+			Claimed:     now,
+			Ttl:         time.Now().Add(rce.IdempotencyKeyTtl).Unix(),
+		},
+	})
+	if err != nil {
+		panic(err)
+	}
+	claimed := true
+	err = lib.Retry(ctx, func() error {
+		_, err := lib.DynamoDBClient().PutItemWithContext(ctx, &dynamodb.PutItemInput{
+			TableName:           aws.String(os.Getenv("PROJECT_NAME")),
+			Item:                item,
+			ConditionExpression: aws.String("attribute_not_exists(id)"),
+		})
 		if err != nil {
-			panic(err)
+			aerr, ok := err.(awserr.Error)
+			if ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+				claimed = false
+				return nil
+			}
 		}
-		hash := sha256.Sum256(data)
-		hashHex := hex.EncodeToString(hash[:])
-		size := humanize.Bytes(uint64(info.Size()))
-		val[file] = fmt.Sprintf("%s %s", hashHex, size)
-		return nil
+		return err
 	})
 	if err != nil {
 		panic(err)
 	}
-	data, err := json.Marshal(val)
+	if claimed {
+		return id, now, nil
+	}
+	recordKey, err := dynamodbattribute.MarshalMap(rce.RecordKey{
+		ID: recordId,
+	})
 	if err != nil {
 		panic(err)
 	}
-	res <- events.APIGatewayProxyResponse{
-		StatusCode: 200,
+	var out *dynamodb.GetItemOutput
+	err = lib.Retry(ctx, func() error {
+		var err error
+		out, err = lib.DynamoDBClient().GetItemWithContext(ctx, &dynamodb.GetItemInput{
+			TableName:      aws.String(os.Getenv("PROJECT_NAME")),
+			Key:            recordKey,
+			ConsistentRead: aws.Bool(true),
+		})
+		return err
+	})
+	if err != nil {
+		panic(err)
+	}
+	if out.Item == nil {
+		// expired between the put and the get
+		return "", 0, errIdempotencyInProgress
+	}
+	record := rce.IdempotencyRecord{}
+	err = dynamodbattribute.UnmarshalMap(out.Item, &record)
+	if err != nil {
+		panic(err)
+	}
+	if record.RequestHash != requestHash {
+		return "", 0, fmt.Errorf("%s was already used with a different request", rce.IdempotencyKeyHeader)
+	}
+	if record.State != rce.IdempotencyClaimed {
+		return record.Uid, 0, nil
+	}
+	if now-record.Claimed < rce.IdempotencyClaimTimeout.Milliseconds() {
+		return "", 0, errIdempotencyInProgress
+	}
+	tookOver := true
+	err = lib.Retry(ctx, func() error {
+		_, err := lib.DynamoDBClient().UpdateItemWithContext(ctx, &dynamodb.UpdateItemInput{
+			TableName:           aws.String(os.Getenv("PROJECT_NAME")),
+			Key:                 recordKey,
+			UpdateExpression:    aws.String("SET #c = :now"),
+			ConditionExpression: aws.String("#s = :claimed AND #c = :prev"),
+			ExpressionAttributeNames: map[string]*string{
+				"#s": aws.String("state"),
+				"#c": aws.String("claimed"),
+			},
+			ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+				":claimed": {S: aws.String(rce.IdempotencyClaimed)},
+				":prev":    {N: aws.String(fmt.Sprint(record.Claimed))},
+				":now":     {N: aws.String(fmt.Sprint(now))},
+			},
+		})
+		if err != nil {
+			aerr, ok := err.(awserr.Error)
+			if ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+				tookOver = false
+				return nil
+			}
+		}
+		return err
+	})
+	if err != nil {
+		panic(err)
+	}
+	if !tookOver {
+		return "", 0, errIdempotencyInProgress
+	}
+	return record.Uid, now, nil
+}
+
+// mark the key submitted, so later requests replay it. if the claim was
+// taken over meanwhile, the request that took it marks it instead.
+func submittedIdempotencyKey(ctx context.Context, authName, key string, claimed int64) {
+	recordKey, err := dynamodbattribute.MarshalMap(rce.RecordKey{
+		ID: rce.IdempotencyRecordID(authName, key),
+	})
+	if err != nil {
+		panic(err)
+	}
+	err = lib.Retry(ctx, func() error {
+		_, err := lib.DynamoDBClient().UpdateItemWithContext(ctx, &dynamodb.UpdateItemInput{
+			TableName:           aws.String(os.Getenv("PROJECT_NAME")),
+			Key:                 recordKey,
+			UpdateExpression:    aws.String("SET #s = :submitted"),
+			ConditionExpression: aws.String("#c = :claimed"),
+			ExpressionAttributeNames: map[string]*string{
+				"#s": aws.String("state"),
+				"#c": aws.String("claimed"),
+			},
+			ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+				":submitted": {S: aws.String(rce.IdempotencySubmitted)},
+				":claimed":   {N: aws.String(fmt.Sprint(claimed))},
+			},
+		})
+		if err != nil {
+			aerr, ok := err.(awserr.Error)
+			if ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+				return nil
+			}
+		}
+		return err
+	})
+	if err != nil {
+		panic(err)
+	}
+}
+
+func httpExecDelete(ctx context.Context, event *events.APIGatewayProxyRequest, res chan<- events.APIGatewayProxyResponse, authName string) {
+	bucket := os.Getenv("PROJECT_BUCKET")
+	uid := event.QueryStringParameters["uid"]
+	err := rce.ValidateUid(uid)
+	if err != nil {
+		res <- badRequest(ctx, err)
+		return
+	}
+	headers := map[string]string{
+		"auth-name":    authName,
+		"uid":          uid,
+		"Content-Type": "application/json",
+	}
+	cancelJob(ctx, bucket, authName, uid)
+	res <- events.APIGatewayProxyResponse{
+		StatusCode: 200,
+		Body:       "{}",
+		Headers:    headers,
+	}
+}
+
+// the async event polls for this key and stops the job when it appears
+func cancelJob(ctx context.Context, bucket, authName, uid string) {
+	cancelKey := fmt.Sprintf("jobs/%s/%s/cancel", authName, uid)
+	err := lib.Retry(ctx, func() error {
+		_, err := lib.S3Client().PutObjectWithContext(ctx, &s3.PutObjectInput{
+			Bucket: aws.String(bucket),
+			Key:    aws.String(cancelKey),
+			Body:   bytes.NewReader([]byte(timestamp())),
+		})
+		return err
+	})
+	if err != nil {
+		panic(err)
+	}
+}
+
+// submit several jobs as a group, see rce.BatchPostRequest
+func httpExecBatchPost(ctx context.Context, event *events.APIGatewayProxyRequest, res chan<- events.APIGatewayProxyResponse, authName string) {
+	if event.IsBase64Encoded {
+		data, err := base64.StdEncoding.DecodeString(event.Body)
+		if err != nil {
+			panic(err)
+		}
+		event.Body = string(data)
+	}
+	if len(event.Body) > rce.MaxBatchPostBytes {
+		res <- badRequest(ctx, fmt.Errorf("body is %d bytes, more than %d", len(event.Body), rce.MaxBatchPostBytes))
+		return
+	}
+	batchRequest := rce.BatchPostRequest{}
+	err := json.Unmarshal([]byte(event.Body), &batchRequest)
+	if err != nil {
+		res <- badRequest(ctx, fmt.Errorf("bad json: %w", err))
+		return
+	}
+	jobs, err := batchRequest.Expand()
+	if err != nil {
+		res <- badRequest(ctx, err)
+		return
+	}
+	groupId := newUid()
+	var uids []string
+	for range jobs {
+		uids = append(uids, newUid())
+	}
+	replayed := false
+	var claimed int64
+	idempotencyKey, ok := rce.CaseInsensitiveGet(event.Headers, rce.IdempotencyKeyHeader)
+	if ok {
+		err := rce.ValidateIdempotencyKey(idempotencyKey)
+		if err != nil {
+			res <- badRequest(ctx, err)
+			return
+		}
+		var existingId string
+		existingId, claimed, err = claimIdempotencyKey(ctx, authName, idempotencyKey, rce.Blake2b32(event.Body), groupId)
+		if err != nil {
+			res <- idempotencyError(ctx, err)
+			return
+		}
+		replayed = existingId != groupId
+		groupId = existingId
+	}
+	if replayed && claimed == 0 {
+		record, err := getGroupRecord(ctx, groupId)
+		if err != nil {
+			panic(err)
+		}
+		if record == nil {
+			res <- notfound(ctx)
+			return
+		}
+		uids = record.Uids
+	} else {
+		// when the first request failed partway, the group record has
+		// the uids it used, and only the jobs it did not submit are
+		// submitted. the body is the same, so jobs expand in the same order.
+		var created bool
+		uids, created = putGroupRecord(ctx, authName, groupId, uids)
+		if len(uids) != len(jobs) {
+			panic(fmt.Sprintf("group %s has %d uids for %d jobs", groupId, len(uids), len(jobs)))
+		}
+		var records []*rce.JobRecord
+		if !created {
+			records = getJobRecords(ctx, uids)
+		}
+		for i, uid := range uids {
+			switch {
+			case records == nil || records[i] == nil:
+				submitJob(ctx, authName, event.RequestContext.Identity.SourceIP, uid, groupId, "", &jobs[i])
+			case records[i].State == rce.StateSubmitted:
+				invokeJob(ctx, jobEvent(ctx, authName, uid, &jobs[i]))
+			default:
+			}
+		}
+	}
+	if claimed != 0 {
+		submittedIdempotencyKey(ctx, authName, idempotencyKey, claimed)
+	}
+	data, err := json.Marshal(rce.BatchPostResponse{
+		GroupId: groupId,
+		Uids:    uids,
+	})
+	if err != nil {
+		panic(err)
+	}
+	headers := map[string]string{
+		"auth-name":    authName,
+		"uid":          groupId,
+		"Content-Type": "application/json",
+	}
+	if replayed {
+		headers[rce.IdempotentReplayedHeader] = "true"
+	}
+	res <- events.APIGatewayProxyResponse{
+		StatusCode: 200,
+		Body:       string(data),
+		Headers:    headers,
+	}
+}
+
+// write the group record unless it exists, returning the uids it holds
+// and whether it was written here
+func putGroupRecord(ctx context.Context, authName, groupId string, uids []string) ([]string, bool) {
+	now := time.Now()
+	item, err := dynamodbattribute.MarshalMap(rce.GroupRecord{
+		RecordKey: rce.RecordKey{
+			ID: rce.GroupRecordID(groupId),
+		},
+		GroupRecordData: rce.GroupRecordData{
+			AuthName:  authName,
+			Uids:      uids,
+			Submitted: now.UnixNano() / 1e6,
+			Ttl:       now.Add(time.Duration(jobTtlDays()) * 24 * time.Hour).Unix(),
+		},
+	})
+	if err != nil {
+		panic(err)
+	}
+	created := true
+	err = lib.Retry(ctx, func() error {
+		_, err := lib.DynamoDBClient().PutItemWithContext(ctx, &dynamodb.PutItemInput{
+			TableName:           aws.String(os.Getenv("PROJECT_NAME")),
+			Item:                item,
+			ConditionExpression: aws.String("attribute_not_exists(id)"),
+		})
+		if err != nil {
+			aerr, ok := err.(awserr.Error)
+			if ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+				created = false
+				return nil
+			}
+		}
+		return err
+	})
+	if err != nil {
+		panic(err)
+	}
+	if created {
+		return uids, true
+	}
+	record, err := getGroupRecord(ctx, groupId)
+	if err != nil {
+		panic(err)
+	}
+	if record == nil {
+		panic(fmt.Sprintf("group %s expired while submitting", groupId))
+	}
+	return record.Uids, false
+}
+
+// returns nil if the group does not exist
+func getGroupRecord(ctx context.Context, id string) (*rce.GroupRecord, error) {
+	key, err := dynamodbattribute.MarshalMap(rce.RecordKey{
+		ID: rce.GroupRecordID(id),
+	})
+	if err != nil {
+		return nil, err
+	}
+	var out *dynamodb.GetItemOutput
+	err = lib.Retry(ctx, func() error {
+		var err error
+		out, err = lib.DynamoDBClient().GetItemWithContext(ctx, &dynamodb.GetItemInput{
+			TableName:      aws.String(os.Getenv("PROJECT_NAME")),
+			Key:            key,
+			ConsistentRead: aws.Bool(true),
+		})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(out.Item) == 0 {
+		return nil, nil
+	}
+	record := &rce.GroupRecord{}
+	err = dynamodbattribute.UnmarshalMap(out.Item, record)
+	if err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// get up to 100 job records in the order of uids, nil where missing
+func getJobRecords(ctx context.Context, uids []string) []*rce.JobRecord {
+	table := os.Getenv("PROJECT_NAME")
+	index := map[string]int{}
+	var keys []map[string]*dynamodb.AttributeValue
+	for i, uid := range uids {
+		index[rce.JobRecordID(uid)] = i
+		key, err := dynamodbattribute.MarshalMap(rce.RecordKey{
+			ID: rce.JobRecordID(uid),
+		})
+		if err != nil {
+			panic(err)
+		}
+		keys = append(keys, key)
+	}
+	records := make([]*rce.JobRecord, len(uids))
+	requestItems := map[string]*dynamodb.KeysAndAttributes{
+		table: {
+			Keys:           keys,
+			ConsistentRead: aws.Bool(true),
+		},
+	}
+	for len(keys) > 0 {
+		var out *dynamodb.BatchGetItemOutput
+		err := lib.Retry(ctx, func() error {
+			var err error
+			out, err = lib.DynamoDBClient().BatchGetItemWithContext(ctx, &dynamodb.BatchGetItemInput{
+				RequestItems: requestItems,
+			})
+			return err
+		})
+		if err != nil {
+			panic(err)
+		}
+		for _, item := range out.Responses[table] {
+			record := &rce.JobRecord{}
+			err := dynamodbattribute.UnmarshalMap(item, record)
+			if err != nil {
+				panic(err)
+			}
+			records[index[record.ID]] = record
+		}
+		unprocessed, ok := out.UnprocessedKeys[table]
+		if !ok || len(unprocessed.Keys) == 0 {
+			break
+		}
+		requestItems = out.UnprocessedKeys
+		time.Sleep(100 * time.Millisecond)
+	}
+	return records
+}
+
+// the group id is the last path segment, like /api/groups/<id>
+func httpGroupGet(ctx context.Context, event *events.APIGatewayProxyRequest, res chan<- events.APIGatewayProxyResponse, authName string) {
+	id := last(strings.Split(event.Path, "/"))
+	err := rce.ValidateGroupId(id)
+	if err != nil {
+		res <- badRequest(ctx, err)
+		return
+	}
+	record, err := getGroupRecord(ctx, id)
+	if err != nil {
+		panic(err)
+	}
+	if record == nil || record.AuthName != authName {
+		res <- notfound(ctx)
+		return
+	}
+	var jobs []rce.JobStatus
+	for i, jobRecord := range getJobRecords(ctx, record.Uids) {
+		if jobRecord == nil {
+			// the batch post is still submitting this job
+			jobs = append(jobs, rce.JobStatus{
+				Uid:      record.Uids[i],
+				AuthName: authName,
+				State:    rce.StateSubmitted,
+				Group:    id,
+			})
+			continue
+		}
+		jobs = append(jobs, *jobRecord.Status())
+	}
+	data, err := json.Marshal(rce.NewGroupStatus(id, jobs))
+	if err != nil {
+		panic(err)
+	}
+	res <- events.APIGatewayProxyResponse{
+		StatusCode: 200,
+		Body:       string(data),
+		Headers: map[string]string{
+			"auth-name":    authName,
+			"uid":          id,
+			"Content-Type": "application/json",
+		},
+	}
+}
+
+// cancel every job in the group
+func httpGroupDelete(ctx context.Context, event *events.APIGatewayProxyRequest, res chan<- events.APIGatewayProxyResponse, authName string) {
+	bucket := os.Getenv("PROJECT_BUCKET")
+	id := last(strings.Split(event.Path, "/"))
+	err := rce.ValidateGroupId(id)
+	if err != nil {
+		res <- badRequest(ctx, err)
+		return
+	}
+	record, err := getGroupRecord(ctx, id)
+	if err != nil {
+		panic(err)
+	}
+	if record == nil || record.AuthName != authName {
+		res <- notfound(ctx)
+		return
+	}
+	for _, uid := range record.Uids {
+		cancelJob(ctx, bucket, authName, uid)
+	}
+	res <- events.APIGatewayProxyResponse{
+		StatusCode: 200,
+		Body:       "{}",
+		Headers: map[string]string{
+			"auth-name":    authName,
+			"uid":          id,
+			"Content-Type": "application/json",
+		},
+	}
+}
+
+func httpSchedulesPost(ctx context.Context, event *events.APIGatewayProxyRequest, res chan<- events.APIGatewayProxyResponse, authName string) {
+	if event.IsBase64Encoded {
+		data, err := base64.StdEncoding.DecodeString(event.Body)
+		if err != nil {
+			panic(err)
+		}
+		event.Body = string(data)
+	}
+	if len(event.Body) > rce.MaxExecPostBytes {
+		res <- badRequest(ctx, fmt.Errorf("body is %d bytes, more than %d", len(event.Body), rce.MaxExecPostBytes))
+		return
+	}
+	scheduleRequest := rce.SchedulePostRequest{}
+	err := json.Unmarshal([]byte(event.Body), &scheduleRequest)
+	if err != nil {
+		res <- badRequest(ctx, fmt.Errorf("bad json: %w", err))
+		return
+	}
+	err = scheduleRequest.Validate()
+	if err != nil {
+		res <- badRequest(ctx, err)
+		return
+	}
+	id := uuid.Must(uuid.NewV4()).String()
+	var claimed int64
+	idempotencyKey, ok := rce.CaseInsensitiveGet(event.Headers, rce.IdempotencyKeyHeader)
+	if ok {
+		err := rce.ValidateIdempotencyKey(idempotencyKey)
+		if err != nil {
+			res <- badRequest(ctx, err)
+			return
+		}
+		var existingId string
+		existingId, claimed, err = claimIdempotencyKey(ctx, authName, idempotencyKey, rce.Blake2b32(event.Body), id)
+		if err != nil {
+			res <- idempotencyError(ctx, err)
+			return
+		}
+		if claimed == 0 {
+			record, err := getScheduleRecord(ctx, existingId)
+			if err != nil {
+				panic(err)
+			}
+			if record == nil {
+				res <- notfound(ctx)
+				return
+			}
+			scheduleRespond(res, authName, record, true)
+			return
+		}
+		// the same id, or that of a request that failed before submitting
+		id = existingId
+	}
+	auth, _ := rce.CaseInsensitiveGet(event.Headers, "auth")
+	cron, err := rce.ParseCron(scheduleRequest.Cron)
+	if err != nil {
+		panic(err)
+	}
+	now := time.Now()
+	record := &rce.ScheduleRecord{
+		RecordKey: rce.RecordKey{
+			ID: rce.ScheduleRecordID(id),
+		},
+		ScheduleRecordData: rce.ScheduleRecordData{
+			SchedulePostRequest: scheduleRequest,
+			AuthName:            authName,
+			AuthId:              fmt.Sprintf("auth.%s", rce.Blake2b32(auth)),
+			Shard:               rce.ScheduleShard,
+			Created:             now.UnixNano() / 1e6,
+			Next:                cron.Next(now).UnixNano() / 1e6,
+		},
+	}
+	created, err := putScheduleRecord(ctx, record)
+	if err != nil {
+		res <- badRequest(ctx, err)
+		return
+	}
+	if !created {
+		// put by a request with the same idempotency key that failed
+		// before marking the key submitted
+		record, err = getScheduleRecord(ctx, id)
+		if err != nil {
+			panic(err)
+		}
+		if record == nil {
+			panic("schedule missing after put: " + id)
+		}
+	}
+	if claimed != 0 {
+		submittedIdempotencyKey(ctx, authName, idempotencyKey, claimed)
+	}
+	scheduleRespond(res, authName, record, false)
+}
+
+var errTooManySchedules = fmt.Errorf("more than %d schedules", rce.MaxSchedules)
+
+// put a new schedule and count it against the MaxSchedules of its auth
+// in one transaction. returns false if the schedule already exists, and
+// errTooManySchedules if the auth is at the limit.
+func putScheduleRecord(ctx context.Context, record *rce.ScheduleRecord) (bool, error) {
+	item, err := dynamodbattribute.MarshalMap(record)
+	if err != nil {
+		panic(err)
+	}
+	countKey, err := dynamodbattribute.MarshalMap(rce.RecordKey{
+		ID: rce.ScheduleCountRecordID(record.AuthName),
+	})
+	if err != nil {
+		panic(err)
+	}
+	created := true
+	var countErr error
+	err = lib.Retry(ctx, func() error {
+		_, err := lib.DynamoDBClient().TransactWriteItemsWithContext(ctx, &dynamodb.TransactWriteItemsInput{
+			TransactItems: []*dynamodb.TransactWriteItem{
+				{Update: &dynamodb.Update{
+					TableName:           aws.String(os.Getenv("PROJECT_NAME")),
+					Key:                 countKey,
+					UpdateExpression:    aws.String("ADD #c :one"),
+					ConditionExpression: aws.String("attribute_not_exists(#c) OR #c < :max"),
+					ExpressionAttributeNames: map[string]*string{
+						"#c": aws.String("count"),
+					},
+					ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+						":one": {N: aws.String("1")},
+						":max": {N: aws.String(fmt.Sprint(rce.MaxSchedules))},
+					},
+				}},
+				{Put: &dynamodb.Put{
+					TableName:           aws.String(os.Getenv("PROJECT_NAME")),
+					Item:                item,
+					ConditionExpression: aws.String("attribute_not_exists(id)"),
+				}},
+			},
+		})
+		if err != nil {
+			cerr, ok := err.(*dynamodb.TransactionCanceledException)
+			if ok && len(cerr.CancellationReasons) == 2 {
+				if aws.StringValue(cerr.CancellationReasons[1].Code) == "ConditionalCheckFailed" {
+					created = false
+					return nil
+				}
+				if aws.StringValue(cerr.CancellationReasons[0].Code) == "ConditionalCheckFailed" {
+					countErr = errTooManySchedules
+					return nil
+				}
+			}
+		}
+		return err
+	})
+	if err != nil {
+		panic(err)
+	}
+	return created, countErr
+}
+
+// delete a schedule and uncount it in one transaction. returns false
+// if it was already deleted.
+func deleteScheduleRecord(ctx context.Context, record *rce.ScheduleRecord) bool {
+	key, err := dynamodbattribute.MarshalMap(rce.RecordKey{
+		ID: record.ID,
+	})
+	if err != nil {
+		panic(err)
+	}
+	countKey, err := dynamodbattribute.MarshalMap(rce.RecordKey{
+		ID: rce.ScheduleCountRecordID(record.AuthName),
+	})
+	if err != nil {
+		panic(err)
+	}
+	deleted := true
+	err = lib.Retry(ctx, func() error {
+		_, err := lib.DynamoDBClient().TransactWriteItemsWithContext(ctx, &dynamodb.TransactWriteItemsInput{
+			TransactItems: []*dynamodb.TransactWriteItem{
+				{Delete: &dynamodb.Delete{
+					TableName:           aws.String(os.Getenv("PROJECT_NAME")),
+					Key:                 key,
+					ConditionExpression: aws.String("attribute_exists(id)"),
+				}},
+				{Update: &dynamodb.Update{
+					TableName:        aws.String(os.Getenv("PROJECT_NAME")),
+					Key:              countKey,
+					UpdateExpression: aws.String("ADD #c :minus"),
+					ExpressionAttributeNames: map[string]*string{
+						"#c": aws.String("count"),
+					},
+					ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+						":minus": {N: aws.String("-1")},
+					},
+				}},
+			},
+		})
+		if err != nil {
+			cerr, ok := err.(*dynamodb.TransactionCanceledException)
+			if ok && len(cerr.CancellationReasons) == 2 && aws.StringValue(cerr.CancellationReasons[0].Code) == "ConditionalCheckFailed" {
+				deleted = false
+				return nil
+			}
+		}
+		return err
+	})
+	if err != nil {
+		panic(err)
+	}
+	return deleted
+}
+
+func scheduleRespond(res chan<- events.APIGatewayProxyResponse, authName string, record *rce.ScheduleRecord, replayed bool) {
+	schedule := record.Schedule()
+	data, err := json.Marshal(schedule)
+	if err != nil {
+		panic(err)
+	}
+	headers := map[string]string{
+		"auth-name":    authName,
+		"uid":          schedule.Id,
+		"Content-Type": "application/json",
+	}
+	if replayed {
+		headers[rce.IdempotentReplayedHeader] = "true"
+	}
+	res <- events.APIGatewayProxyResponse{
+		StatusCode: 200,
+		Body:       string(data),
+		Headers:    headers,
+	}
+}
+
+func httpSchedulesGet(ctx context.Context, _ *events.APIGatewayProxyRequest, res chan<- events.APIGatewayProxyResponse, authName string) {
+	schedulesResp := rce.SchedulesGetResponse{
+		Schedules: []rce.Schedule{},
+	}
+	for _, record := range querySchedules(ctx, authName, math.MaxInt64) {
+		schedulesResp.Schedules = append(schedulesResp.Schedules, *record.Schedule())
+	}
+	sort.Slice(schedulesResp.Schedules, func(i, j int) bool {
+		return schedulesResp.Schedules[i].Created.Before(schedulesResp.Schedules[j].Created)
+	})
+	data, err := json.Marshal(schedulesResp)
+	if err != nil {
+		panic(err)
+	}
+	res <- events.APIGatewayProxyResponse{
+		StatusCode: 200,
+		Body:       string(data),
+		Headers: map[string]string{
+			"auth-name":    authName,
+			"Content-Type": "application/json",
+		},
+	}
+}
+
+// the schedule id is the last path segment, like /api/schedules/<id>
+func httpScheduleGet(ctx context.Context, event *events.APIGatewayProxyRequest, res chan<- events.APIGatewayProxyResponse, authName string) {
+	id := last(strings.Split(event.Path, "/"))
+	err := rce.ValidateScheduleId(id)
+	if err != nil {
+		res <- badRequest(ctx, err)
+		return
+	}
+	record, err := getScheduleRecord(ctx, id)
+	if err != nil {
+		panic(err)
+	}
+	if record == nil || record.AuthName != authName {
+		res <- notfound(ctx)
+		return
+	}
+	jobsResp, err := queryJobs(ctx, authName, rce.JobsQuery{
+		Schedule: id,
+		Limit:    rce.ScheduleRunsLimit,
+	})
+	if err != nil {
+		panic(err)
+	}
+	data, err := json.Marshal(rce.ScheduleGetResponse{
+		Schedule: *record.Schedule(),
+		Runs:     jobsResp.Jobs,
+	})
+	if err != nil {
+		panic(err)
+	}
+	res <- events.APIGatewayProxyResponse{
+		StatusCode: 200,
+		Body:       string(data),
+		Headers: map[string]string{
+			"auth-name":    authName,
+			"uid":          id,
+			"Content-Type": "application/json",
+		},
+	}
+}
+
+// remove a schedule, its past runs are kept
+func httpScheduleDelete(ctx context.Context, event *events.APIGatewayProxyRequest, res chan<- events.APIGatewayProxyResponse, authName string) {
+	id := last(strings.Split(event.Path, "/"))
+	err := rce.ValidateScheduleId(id)
+	if err != nil {
+		res <- badRequest(ctx, err)
+		return
+	}
+	record, err := getScheduleRecord(ctx, id)
+	if err != nil {
+		panic(err)
+	}
+	if record == nil || record.AuthName != authName {
+		res <- notfound(ctx)
+		return
+	}
+	deleteScheduleRecord(ctx, record)
+	res <- events.APIGatewayProxyResponse{
+		StatusCode: 200,
+		Body:       "{}",
+		Headers: map[string]string{
+			"auth-name":    authName,
+			"uid":          id,
+			"Content-Type": "application/json",
+		},
+	}
+}
+
+// returns nil if the schedule does not exist
+func getScheduleRecord(ctx context.Context, id string) (*rce.ScheduleRecord, error) {
+	key, err := dynamodbattribute.MarshalMap(rce.RecordKey{
+		ID: rce.ScheduleRecordID(id),
+	})
+	if err != nil {
+		return nil, err
+	}
+	var out *dynamodb.GetItemOutput
+	err = lib.Retry(ctx, func() error {
+		var err error
+		out, err = lib.DynamoDBClient().GetItemWithContext(ctx, &dynamodb.GetItemInput{
+			TableName:      aws.String(os.Getenv("PROJECT_NAME")),
+			Key:            key,
+			ConsistentRead: aws.Bool(true),
+		})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(out.Item) == 0 {
+		return nil, nil
+	}
+	record := &rce.ScheduleRecord{}
+	err = dynamodbattribute.UnmarshalMap(out.Item, record)
+	if err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// query the schedules index for schedules with next at or before until,
+// in unix millis, of one auth, or of every auth if authName is empty
+func querySchedules(ctx context.Context, authName string, until int64) []*rce.ScheduleRecord {
+	input := &dynamodb.QueryInput{
+		TableName:              aws.String(os.Getenv("PROJECT_NAME")),
+		IndexName:              aws.String(rce.SchedulesIndex),
+		KeyConditionExpression: aws.String("#s = :s AND #n <= :until"),
+		ExpressionAttributeNames: map[string]*string{
+			"#s": aws.String("schedule-shard"),
+			"#n": aws.String("next"),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":s":     {S: aws.String(rce.ScheduleShard)},
+			":until": {N: aws.String(fmt.Sprint(until))},
+		},
+	}
+	if authName != "" {
+		input.FilterExpression = aws.String("#a = :a")
+		input.ExpressionAttributeNames["#a"] = aws.String("auth-name")
+		input.ExpressionAttributeValues[":a"] = &dynamodb.AttributeValue{S: aws.String(authName)}
+	}
+	var records []*rce.ScheduleRecord
+	for {
+		var out *dynamodb.QueryOutput
+		err := lib.Retry(ctx, func() error {
+			var err error
+			out, err = lib.DynamoDBClient().QueryWithContext(ctx, input)
+			return err
+		})
+		if err != nil {
+			panic(err)
+		}
+		for _, item := range out.Items {
+			record := &rce.ScheduleRecord{}
+			err := dynamodbattribute.UnmarshalMap(item, record)
+			if err != nil {
+				panic(err)
+			}
+			records = append(records, record)
+		}
+		if out.LastEvaluatedKey == nil {
+			break
+		}
+		input.ExclusiveStartKey = out.LastEvaluatedKey
+	}
+	return records
+}
+
+// claim the run of a due schedule by moving next forward, conditional
+// on next being unchanged, so overlapping ticks run it once. returns
+// false if another tick claimed it.
+func claimScheduleRun(ctx context.Context, record *rce.ScheduleRecord, uid string, now time.Time) bool {
+	cron, err := rce.ParseCron(record.Cron)
+	if err != nil {
+		panic(err)
+	}
+	next := cron.Next(now)
+	key, err := dynamodbattribute.MarshalMap(rce.RecordKey{
+		ID: record.ID,
+	})
+	if err != nil {
+		panic(err)
+	}
+	claimed := true
+	err = lib.Retry(ctx, func() error {
+		_, err := lib.DynamoDBClient().UpdateItemWithContext(ctx, &dynamodb.UpdateItemInput{
+			TableName:           aws.String(os.Getenv("PROJECT_NAME")),
+			Key:                 key,
+			UpdateExpression:    aws.String("SET #n = :next, #r = :uid, #ra = :now"),
+			ConditionExpression: aws.String("#n = :prev"),
+			ExpressionAttributeNames: map[string]*string{
+				"#n":  aws.String("next"),
+				"#r":  aws.String("last-run"),
+				"#ra": aws.String("last-run-at"),
+			},
+			ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+				":next": {N: aws.String(fmt.Sprint(next.UnixNano() / 1e6))},
+				":prev": {N: aws.String(fmt.Sprint(record.Next))},
+				":uid":  {S: aws.String(uid)},
+				":now":  {N: aws.String(fmt.Sprint(now.UnixNano() / 1e6))},
+			},
+		})
+		if err != nil {
+			aerr, ok := err.(awserr.Error)
+			if ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+				claimed = false
+				return nil
+			}
+		}
+		return err
+	})
+	if err != nil {
+		panic(err)
+	}
+	return claimed
+}
+
+func authExists(ctx context.Context, authId string) bool {
+	key, err := dynamodbattribute.MarshalMap(rce.RecordKey{
+		ID: authId,
+	})
+	if err != nil {
+		panic(err)
+	}
+	var out *dynamodb.GetItemOutput
+	err = lib.Retry(ctx, func() error {
+		var err error
+		out, err = lib.DynamoDBClient().GetItemWithContext(ctx, &dynamodb.GetItemInput{
+			TableName:      aws.String(os.Getenv("PROJECT_NAME")),
+			Key:            key,
+			ConsistentRead: aws.Bool(true),
+		})
+		return err
+	})
+	if err != nil {
+		panic(err)
+	}
+	return len(out.Item) != 0
+}
+
+// submit a job for each due schedule via the same async event as a post
+// to /api/exec. schedules whose auth was removed are deleted, since they
+// can never run again and would otherwise stay due forever.
+func dispatchSchedules(ctx context.Context) {
+	now := time.Now()
+	for _, record := range querySchedules(ctx, "", now.UnixNano()/1e6) {
+		if !authExists(ctx, record.AuthId) {
+			if deleteScheduleRecord(ctx, record) {
+				lib.Logger.Println("removed schedule of removed auth:", record.ID, record.AuthName)
+			}
+			continue
+		}
+		uid := newUid()
+		if !claimScheduleRun(ctx, record, uid, now) {
+			continue
+		}
+		schedule := record.Schedule()
+		lib.Logger.Println("dispatch schedule:", schedule.Id, record.AuthName, uid)
+		submitJob(ctx, record.AuthName, "-", uid, "", schedule.Id, record.ExecRequest())
+	}
+}
+
+// schedules are dispatched first, so a slow sweep cannot delay them
+func handleScheduledEvent(ctx context.Context, res chan<- events.APIGatewayProxyResponse) {
+	dispatchSchedules(ctx)
+	sweepLostJobs(ctx)
+	res <- events.APIGatewayProxyResponse{
+		StatusCode: 200,
+	}
+}
+
+// mark a submitted job running, returns false if it is not submitted
+func startJobRecord(ctx context.Context, uid string, start time.Time) bool {
+	key, err := dynamodbattribute.MarshalMap(rce.RecordKey{
+		ID: rce.JobRecordID(uid),
+	})
+	if err != nil {
+		panic(err)
+	}
+	started := true
+	err = lib.Retry(ctx, func() error {
+		_, err := lib.DynamoDBClient().UpdateItemWithContext(ctx, &dynamodb.UpdateItemInput{
+			TableName:           aws.String(os.Getenv("PROJECT_NAME")),
+			Key:                 key,
+			UpdateExpression:    aws.String("SET #s = :running, #st = :started, #h = :started"),
+			ConditionExpression: aws.String("#s = :submitted"),
+			ExpressionAttributeNames: map[string]*string{
+				"#s":  aws.String("state"),
+				"#st": aws.String("started"),
+				"#h":  aws.String("heartbeat"),
+			},
+			ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+				":running":   {S: aws.String(rce.StateRunning)},
+				":submitted": {S: aws.String(rce.StateSubmitted)},
+				":started":   {N: aws.String(fmt.Sprint(start.UnixNano() / 1e6))},
+			},
+		})
+		if err != nil {
+			aerr, ok := err.(awserr.Error)
+			if ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+				started = false
+				return nil
+			}
+		}
+		return err
+	})
+	if err != nil {
+		panic(err)
+	}
+	return started
+}
+
+// finalize jobs whose heartbeat is older than LostJobTimeout, since the
+// async lambda crashed, ran out of memory, hit the lambda timeout, or
+// never started. each gets a final log line, exit, and size, so callers
+// following the log stop as if it exited.
+func sweepLostJobs(ctx context.Context) {
+	now := time.Now()
+	input := &dynamodb.QueryInput{
+		TableName:              aws.String(os.Getenv("PROJECT_NAME")),
+		IndexName:              aws.String(rce.ActiveIndex),
+		KeyConditionExpression: aws.String("#a = :a AND #h < :stale"),
+		ExpressionAttributeNames: map[string]*string{
+			"#a": aws.String("active"),
+			"#h": aws.String("heartbeat"),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":a":     {S: aws.String(rce.ActiveShard)},
+			":stale": {N: aws.String(fmt.Sprint(now.Add(-rce.LostJobTimeout).UnixNano() / 1e6))},
+		},
+	}
+	for {
+		var out *dynamodb.QueryOutput
+		err := lib.Retry(ctx, func() error {
+			var err error
+			out, err = lib.DynamoDBClient().QueryWithContext(ctx, input)
+			return err
+		})
+		if err != nil {
+			panic(err)
+		}
+		for _, item := range out.Items {
+			record := &rce.JobRecord{}
+			err := dynamodbattribute.UnmarshalMap(item, record)
+			if err != nil {
+				panic(err)
+			}
+			sweepLostJob(ctx, record, now)
+		}
+		if out.LastEvaluatedKey == nil {
+			break
+		}
+		input.ExclusiveStartKey = out.LastEvaluatedKey
+	}
+}
+
+// finalize one lost job, logging a failure instead of panicking so the
+// rest of the sweep still runs. a failure before the job is claimed,
+// like listing its log, leaves it to be retried on the next tick.
+func sweepLostJob(ctx context.Context, record *rce.JobRecord, now time.Time) {
+	defer func() {
+		if r := recover(); r != nil {
+			lib.Logger.Println("error: sweep lost job:", record.ID, r)
+		}
+	}()
+	finalizeLostJob(ctx, record, now)
+}
+
+func finalizeLostJob(ctx context.Context, record *rce.JobRecord, now time.Time) {
+	bucket := os.Getenv("PROJECT_BUCKET")
+	uid := record.Status().Uid
+	logSize := 0
+	chunks := 0
+	err := lib.S3Client().ListObjectsV2PagesWithContext(ctx, &s3.ListObjectsV2Input{
+		Bucket: aws.String(bucket),
+		Prefix: aws.String(fmt.Sprintf("jobs/%s/%s/log/", record.AuthName, uid)),
+	}, func(page *s3.ListObjectsV2Output, _ bool) bool {
+		for _, obj := range page.Contents {
+			logSize += int(*obj.Size)
+			chunks++
+		}
+		return true
+	})
+	if err != nil {
+		panic(err)
+	}
+	exitStatus := rce.ExitStatus{
+		Exit:   rce.ExitLost,
+		Reason: rce.ExitReasonLost,
+	}
+	// claim the job first, conditional on the heartbeat it was found
+	// with, so a job that is alive after all is left alone
+	key, err := dynamodbattribute.MarshalMap(rce.RecordKey{
+		ID: record.ID,
+	})
+	if err != nil {
+		panic(err)
+	}
+	frame := rce.EncodeFrame(rce.Stderr, []byte(fmt.Sprintf("lost: no heartbeat since %s\n", lib.FromUnixMilli(record.Heartbeat).UTC().Format(time.RFC3339))))
+	claimed := true
+	err = lib.Retry(ctx, func() error {
+		_, err := lib.DynamoDBClient().UpdateItemWithContext(ctx, &dynamodb.UpdateItemInput{
+			TableName:           aws.String(os.Getenv("PROJECT_NAME")),
+			Key:                 key,
+			UpdateExpression:    aws.String("SET #s = :failed, #e = :ended, #x = :exit, #r = :reason, #l = :size REMOVE #a"),
+			ConditionExpression: aws.String("#h = :heartbeat AND attribute_exists(#a)"),
+			ExpressionAttributeNames: map[string]*string{
+				"#s": aws.String("state"),
+				"#e": aws.String("ended"),
+				"#x": aws.String("exit"),
+				"#r": aws.String("reason"),
+				"#l": aws.String("log-size"),
+				"#a": aws.String("active"),
+				"#h": aws.String("heartbeat"),
+			},
+			ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+				":failed":    {S: aws.String(rce.StateFailed)},
+				":ended":     {N: aws.String(fmt.Sprint(now.UnixNano() / 1e6))},
+				":exit":      {N: aws.String(fmt.Sprint(exitStatus.Exit))},
+				":reason":    {S: aws.String(exitStatus.Reason)},
+				":size":      {N: aws.String(fmt.Sprint(logSize + len(frame)))},
+				":heartbeat": {N: aws.String(fmt.Sprint(record.Heartbeat))},
+			},
+		})
+		if err != nil {
+			aerr, ok := err.(awserr.Error)
+			if ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+				claimed = false
+				return nil
+			}
+		}
+		return err
+	})
+	if err != nil {
+		panic(err)
+	}
+	if !claimed {
+		return
+	}
+	lib.Logger.Println("lost job:", record.AuthName, uid)
+	exitData, err := json.Marshal(exitStatus)
+	if err != nil {
+		panic(err)
+	}
+	// exit and size are written after the log, like the async lambda
+	for _, obj := range []struct {
+		key  string
+		data []byte
+	}{
+		{logChunkKey(record.AuthName, uid, chunks), frame},
+		{fmt.Sprintf("jobs/%s/%s/exit", record.AuthName, uid), exitData},
+		{fmt.Sprintf("jobs/%s/%s/size", record.AuthName, uid), []byte(fmt.Sprint(logSize + len(frame)))},
+	} {
+		obj := obj
+		err := lib.Retry(ctx, func() error {
+			_, err := lib.S3Client().PutObjectWithContext(ctx, &s3.PutObjectInput{
+				Bucket: aws.String(bucket),
+				Key:    aws.String(obj.key),
+				Body:   bytes.NewReader(obj.data),
+			})
+			return err
+		})
+		if err != nil {
+			panic(err)
+		}
+	}
+	if record.Webhook != "" {
+		invokeWebhook(ctx, uid)
+	}
+}
+
+// returns the default webhook of the auth, empty if unset
+func getDefaultWebhook(ctx context.Context, authName string) string {
+	key, err := dynamodbattribute.MarshalMap(rce.RecordKey{
+		ID: rce.WebhookRecordID(authName),
+	})
+	if err != nil {
+		panic(err)
+	}
+	var out *dynamodb.GetItemOutput
+	err = lib.Retry(ctx, func() error {
+		var err error
+		out, err = lib.DynamoDBClient().GetItemWithContext(ctx, &dynamodb.GetItemInput{
+			TableName:      aws.String(os.Getenv("PROJECT_NAME")),
+			Key:            key,
+			ConsistentRead: aws.Bool(true),
+		})
+		return err
+	})
+	if err != nil {
+		panic(err)
+	}
+	record := rce.Record{}
+	err = dynamodbattribute.UnmarshalMap(out.Item, &record)
+	if err != nil {
+		panic(err)
+	}
+	return record.Value
+}
+
+// returns the webhook record of the auth, setting its url if not empty,
+// and creating its secret on first use
+func updateWebhookRecord(ctx context.Context, authName, url string) *rce.WebhookRecord {
+	key, err := dynamodbattribute.MarshalMap(rce.RecordKey{
+		ID: rce.WebhookRecordID(authName),
+	})
+	if err != nil {
+		panic(err)
+	}
+	expr := "SET #s = if_not_exists(#s, :secret)"
+	names := map[string]*string{
+		"#s": aws.String("secret"),
+	}
+	values := map[string]*dynamodb.AttributeValue{
+		":secret": {S: aws.String(rce.RandKey())},
+	}
+	if url != "" {
+		expr += ", #v = :url"
+		names["#v"] = aws.String("value")
+		values[":url"] = &dynamodb.AttributeValue{S: aws.String(url)}
+	}
+	var out *dynamodb.UpdateItemOutput
+	err = lib.Retry(ctx, func() error {
+		var err error
+		out, err = lib.DynamoDBClient().UpdateItemWithContext(ctx, &dynamodb.UpdateItemInput{
+			TableName:                 aws.String(os.Getenv("PROJECT_NAME")),
+			Key:                       key,
+			UpdateExpression:          aws.String(expr),
+			ExpressionAttributeNames:  names,
+			ExpressionAttributeValues: values,
+			ReturnValues:              aws.String(dynamodb.ReturnValueAllNew),
+		})
+		return err
+	})
+	if err != nil {
+		panic(err)
+	}
+	record := &rce.WebhookRecord{}
+	err = dynamodbattribute.UnmarshalMap(out.Attributes, record)
+	if err != nil {
+		panic(err)
+	}
+	return record
+}
+
+func webhookRespond(res chan<- events.APIGatewayProxyResponse, authName string, record *rce.WebhookRecord) {
+	data, err := json.Marshal(rce.WebhookGetResponse{
+		Url:    record.Value,
+		Secret: record.Secret,
+	})
+	if err != nil {
+		panic(err)
+	}
+	res <- events.APIGatewayProxyResponse{
+		StatusCode: 200,
+		Body:       string(data),
+		Headers: map[string]string{
+			"auth-name":    authName,
+			"Content-Type": "application/json",
+		},
+	}
+}
+
+func httpWebhookGet(ctx context.Context, _ *events.APIGatewayProxyRequest, res chan<- events.APIGatewayProxyResponse, authName string) {
+	webhookRespond(res, authName, updateWebhookRecord(ctx, authName, ""))
+}
+
+// set the default webhook of the auth, used by jobs without one
+func httpWebhookPut(ctx context.Context, event *events.APIGatewayProxyRequest, res chan<- events.APIGatewayProxyResponse, authName string) {
+	if event.IsBase64Encoded {
+		data, err := base64.StdEncoding.DecodeString(event.Body)
+		if err != nil {
+			panic(err)
+		}
+		event.Body = string(data)
+	}
+	putRequest := rce.WebhookPutRequest{}
+	err := json.Unmarshal([]byte(event.Body), &putRequest)
+	if err != nil {
+		res <- badRequest(ctx, fmt.Errorf("bad json: %w", err))
+		return
+	}
+	err = rce.ValidateWebhook(putRequest.Url)
+	if err != nil {
+		res <- badRequest(ctx, err)
+		return
+	}
+	err = rce.CheckWebhookHost(ctx, putRequest.Url)
+	if err != nil {
+		res <- badRequest(ctx, err)
+		return
+	}
+	webhookRespond(res, authName, updateWebhookRecord(ctx, authName, putRequest.Url))
+}
+
+// remove the default webhook of the auth, keeping its secret
+func httpWebhookDelete(ctx context.Context, _ *events.APIGatewayProxyRequest, res chan<- events.APIGatewayProxyResponse, authName string) {
+	key, err := dynamodbattribute.MarshalMap(rce.RecordKey{
+		ID: rce.WebhookRecordID(authName),
+	})
+	if err != nil {
+		panic(err)
+	}
+	err = lib.Retry(ctx, func() error {
+		_, err := lib.DynamoDBClient().UpdateItemWithContext(ctx, &dynamodb.UpdateItemInput{
+			TableName:           aws.String(os.Getenv("PROJECT_NAME")),
+			Key:                 key,
+			UpdateExpression:    aws.String("REMOVE #v"),
+			ConditionExpression: aws.String("attribute_exists(id)"),
+			ExpressionAttributeNames: map[string]*string{
+				"#v": aws.String("value"),
+			},
+		})
+		if err != nil {
+			aerr, ok := err.(awserr.Error)
+			if ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+				return nil
+			}
+		}
+		return err
+	})
+	if err != nil {
+		panic(err)
+	}
+	res <- events.APIGatewayProxyResponse{
+		StatusCode: 200,
+		Body:       "{}",
+		Headers: map[string]string{
+			"auth-name":    authName,
+			"Content-Type": "application/json",
+		},
+	}
+}
+
+// deliver the webhook of a job via an async invocation of this lambda,
+// once its record is final, so the caller does not wait on the receiver
+func invokeWebhook(ctx context.Context, uid string) {
+	data, err := json.Marshal(rce.WebhookAsyncEvent{
+		EventType: rce.EventWebhook,
+		Uid:       uid,
+	})
+	if err != nil {
+		panic(err)
+	}
+	err = lib.Retry(ctx, func() error {
+		out, err := lib.LambdaClient().InvokeWithContext(ctx, &sdkLambda.InvokeInput{
+			FunctionName:   aws.String(os.Getenv("AWS_LAMBDA_FUNCTION_NAME")),
+			InvocationType: aws.String(sdkLambda.InvocationTypeEvent),
+			LogType:        aws.String(sdkLambda.LogTypeNone),
+			Payload:        data,
+		})
+		if err != nil {
+			return err
+		}
+		if *out.StatusCode != 202 {
+			return fmt.Errorf("status %d", *out.StatusCode)
+		}
+		return nil
+	})
+	if err != nil {
+		panic(err)
+	}
+}
+
+func handleWebhookEvent(ctx context.Context, event *rce.WebhookAsyncEvent, res chan<- events.APIGatewayProxyResponse) {
+	deliverWebhook(ctx, event.Uid)
+	res <- events.APIGatewayProxyResponse{
+		Body:       "ok",
+		StatusCode: 200,
+		Headers: map[string]string{
+			"uid": event.Uid,
+		},
+	}
+}
+
+// post the final state of a job to its webhook, signed with the secret
+// of its auth, retrying with backoff, and append each attempt to the
+// job record.
+func deliverWebhook(ctx context.Context, uid string) {
+	record, err := getJobRecord(ctx, uid)
+	if err != nil {
+		panic(err)
+	}
+	if record == nil || record.Webhook == "" {
+		return
+	}
+	secret := updateWebhookRecord(ctx, record.AuthName, "").Secret
+	status := record.Status()
+	payload := rce.WebhookPayload{
+		Uid:      uid,
+		AuthName: record.AuthName,
+		Argv:     record.Argv,
+		State:    record.State,
+		Signal:   record.Signal,
+		Reason:   record.Reason,
+		Duration: status.Duration,
+		LogSize:  record.LogSize,
+		LogUrl:   fmt.Sprintf("%s/api/exec/stream?uid=%s", os.Getenv("PROJECT_URL"), uid),
+		Group:    record.Group,
+		Schedule: record.Schedule,
+	}
+	if record.Exit != nil {
+		payload.Exit = *record.Exit
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		panic(err)
+	}
+	// posts only connect to public addresses and do not follow redirects,
+	// so a webhook cannot reach the network of the lambda
+	httpClient := &http.Client{
+		Timeout: rce.WebhookAttemptTimeout,
+		Transport: &http.Transport{
+			DialContext: (&net.Dialer{
+				Timeout: rce.WebhookAttemptTimeout,
+				Control: rce.WebhookDialControl,
+			}).DialContext,
+			TLSHandshakeTimeout: rce.WebhookAttemptTimeout,
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	backoff := time.Second
+	for attempt := 1; attempt <= rce.WebhookAttempts; attempt++ {
+		start := time.Now()
+		delivery := rce.WebhookDelivery{
+			Attempt: attempt,
+			Time:    start.UTC(),
+		}
+		// checked before each attempt, since dns can change between them
+		err := rce.CheckWebhookHost(ctx, record.Webhook)
+		if err != nil {
+			delivery.Error = err.Error()
+			appendWebhookDelivery(ctx, uid, delivery)
+			lib.Logger.Println("webhook error:", uid, attempt, delivery.Error)
+			return
+		}
+		// signed per attempt, so a retry has a fresh timestamp
+		timestamp := start.Unix()
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, record.Webhook, bytes.NewReader(body))
+		if err != nil {
+			panic(err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(rce.WebhookIdHeader, uid)
+		req.Header.Set(rce.WebhookTimestampHeader, fmt.Sprint(timestamp))
+		req.Header.Set(rce.WebhookSignatureHeader, rce.SignWebhook(secret, timestamp, body))
+		resp, err := httpClient.Do(req)
+		if err != nil {
+			delivery.Error = err.Error()
+		} else {
+			_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+			_ = resp.Body.Close()
+			delivery.Status = resp.StatusCode
+			if resp.StatusCode < 200 || resp.StatusCode > 299 {
+				delivery.Error = fmt.Sprintf("expected 2xx, got: %d", resp.StatusCode)
+			}
+		}
+		delivery.Duration = time.Since(start).Seconds()
+		appendWebhookDelivery(ctx, uid, delivery)
+		if delivery.Error == "" {
+			return
+		}
+		lib.Logger.Println("webhook error:", uid, attempt, delivery.Error)
+		if attempt < rce.WebhookAttempts {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+	}
+}
+
+func appendWebhookDelivery(ctx context.Context, uid string, delivery rce.WebhookDelivery) {
+	key, err := dynamodbattribute.MarshalMap(rce.RecordKey{
+		ID: rce.JobRecordID(uid),
+	})
+	if err != nil {
+		panic(err)
+	}
+	val, err := dynamodbattribute.Marshal([]rce.WebhookDelivery{delivery})
+	if err != nil {
+		panic(err)
+	}
+	err = lib.Retry(ctx, func() error {
+		_, err := lib.DynamoDBClient().UpdateItemWithContext(ctx, &dynamodb.UpdateItemInput{
+			TableName:           aws.String(os.Getenv("PROJECT_NAME")),
+			Key:                 key,
+			UpdateExpression:    aws.String("SET #d = list_append(if_not_exists(#d, :empty), :delivery)"),
+			ConditionExpression: aws.String("attribute_exists(id)"),
+			ExpressionAttributeNames: map[string]*string{
+				"#d": aws.String("webhook-deliveries"),
+			},
+			ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+				":empty":    {L: []*dynamodb.AttributeValue{}},
+				":delivery": val,
+			},
+		})
+		if err != nil {
+			// the record expired, rather than creating a partial one
+			aerr, ok := err.(awserr.Error)
+			if ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+				return nil
+			}
+		}
+		return err
+	})
+	if err != nil {
+		panic(err)
+	}
+}
+
+func httpExecArtifactsGet(ctx context.Context, event *events.APIGatewayProxyRequest, res chan<- events.APIGatewayProxyResponse, authName string) {
+	bucket := os.Getenv("PROJECT_BUCKET")
+	uid := event.QueryStringParameters["uid"]
+	err := rce.ValidateUid(uid)
+	if err != nil {
+		res <- badRequest(ctx, err)
+		return
+	}
+	headers := map[string]string{
+		"auth-name":    authName,
+		"uid":          uid,
+		"Content-Type": "application/json",
+	}
+	prefix := fmt.Sprintf("jobs/%s/%s/artifacts/", authName, uid)
+	getResp := rce.ArtifactsGetResponse{
+		Artifacts: []rce.Artifact{},
+	}
+	err = lib.S3Client().ListObjectsV2PagesWithContext(ctx, &s3.ListObjectsV2Input{
+		Bucket: aws.String(bucket),
+		Prefix: aws.String(prefix),
+	}, func(page *s3.ListObjectsV2Output, _ bool) bool {
+		for _, obj := range page.Contents {
+			getResp.Artifacts = append(getResp.Artifacts, rce.Artifact{
+				Path: strings.TrimPrefix(*obj.Key, prefix),
+				Size: *obj.Size,
+				Url:  lib.S3PresignGet(bucket, *obj.Key, "", 15*time.Minute),
+			})
+		}
+		return true
+	})
+	if err != nil {
+		panic(err)
+	}
+	data, err := json.Marshal(getResp)
+	if err != nil {
+		panic(err)
+	}
+	res <- events.APIGatewayProxyResponse{
+		StatusCode: 200,
+		Body:       string(data),
+		Headers:    headers,
+	}
+}
+
+func httpExecStatusGet(ctx context.Context, event *events.APIGatewayProxyRequest, res chan<- events.APIGatewayProxyResponse, authName string) {
+	uid := event.QueryStringParameters["uid"]
+	err := rce.ValidateUid(uid)
+	if err != nil {
+		res <- badRequest(ctx, err)
+		return
+	}
+	record, err := getJobRecord(ctx, uid)
+	if err != nil {
+		panic(err)
+	}
+	if record == nil || record.AuthName != authName {
+		res <- notfound(ctx)
+		return
+	}
+	data, err := json.Marshal(record.Status())
+	if err != nil {
+		panic(err)
+	}
+	res <- events.APIGatewayProxyResponse{
+		StatusCode: 200,
+		Body:       string(data),
+		Headers: map[string]string{
+			"auth-name":    authName,
+			"uid":          uid,
+			"Content-Type": "application/json",
+		},
+	}
+}
+
+// job records expire JOB_TTL_DAYS after submit, defaulting to 30
+func jobTtlDays() int {
+	days, err := strconv.Atoi(os.Getenv("JOB_TTL_DAYS"))
+	if err != nil || days < 1 {
+		return 30
+	}
+	return days
+}
+
+func putJobRecord(ctx context.Context, record *rce.JobRecord) {
+	item, err := dynamodbattribute.MarshalMap(record)
+	if err != nil {
+		panic(err)
+	}
+	err = lib.Retry(ctx, func() error {
+		_, err := lib.DynamoDBClient().PutItemWithContext(ctx, &dynamodb.PutItemInput{
+			TableName: aws.String(os.Getenv("PROJECT_NAME")),
+			Item:      item,
+		})
+		return err
+	})
+	if err != nil {
+		panic(err)
+	}
+}
+
+// set attributes on a running job record, removing those that are nil.
+// returns false if the record is not active, since it was swept as lost,
+// its put failed, or it expired, rather than overwriting the sweep or
+// creating a partial record.
+func updateJobRecord(ctx context.Context, uid string, attrs map[string]interface{}) bool {
+	key, err := dynamodbattribute.MarshalMap(rce.RecordKey{
+		ID: rce.JobRecordID(uid),
+	})
+	if err != nil {
+		panic(err)
+	}
+	var names []string
+	for name := range attrs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var sets []string
+	var removes []string
+	exprNames := map[string]*string{}
+	exprValues := map[string]*dynamodb.AttributeValue{}
+	for i, name := range names {
+		if attrs[name] == nil {
+			removes = append(removes, fmt.Sprintf("#n%d", i))
+			exprNames[fmt.Sprintf("#n%d", i)] = aws.String(name)
+			continue
+		}
+		val, err := dynamodbattribute.Marshal(attrs[name])
+		if err != nil {
+			panic(err)
+		}
+		sets = append(sets, fmt.Sprintf("#n%d = :v%d", i, i))
+		exprNames[fmt.Sprintf("#n%d", i)] = aws.String(name)
+		exprValues[fmt.Sprintf(":v%d", i)] = val
+	}
+	exprNames["#active"] = aws.String("active")
+	expr := "SET " + strings.Join(sets, ", ")
+	if len(removes) > 0 {
+		expr += " REMOVE " + strings.Join(removes, ", ")
+	}
+	updated := true
+	err = lib.Retry(ctx, func() error {
+		_, err := lib.DynamoDBClient().UpdateItemWithContext(ctx, &dynamodb.UpdateItemInput{
+			TableName:                 aws.String(os.Getenv("PROJECT_NAME")),
+			Key:                       key,
+			UpdateExpression:          aws.String(expr),
+			ConditionExpression:       aws.String("attribute_exists(#active)"),
+			ExpressionAttributeNames:  exprNames,
+			ExpressionAttributeValues: exprValues,
+		})
+		if err != nil {
+			aerr, ok := err.(awserr.Error)
+			if ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+				updated = false
+				return nil
+			}
+		}
+		return err
+	})
+	if err != nil {
+		panic(err)
+	}
+	return updated
+}
+
+// returns nil if the job does not exist
+func getJobRecord(ctx context.Context, uid string) (*rce.JobRecord, error) {
+	key, err := dynamodbattribute.MarshalMap(rce.RecordKey{
+		ID: rce.JobRecordID(uid),
+	})
+	if err != nil {
+		return nil, err
+	}
+	var out *dynamodb.GetItemOutput
+	err = lib.Retry(ctx, func() error {
+		var err error
+		out, err = lib.DynamoDBClient().GetItemWithContext(ctx, &dynamodb.GetItemInput{
+			TableName:      aws.String(os.Getenv("PROJECT_NAME")),
+			Key:            key,
+			ConsistentRead: aws.Bool(true),
+		})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(out.Item) == 0 {
+		return nil, nil
+	}
+	record := &rce.JobRecord{}
+	err = dynamodbattribute.UnmarshalMap(out.Item, record)
+	if err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// the next token is the last evaluated key of the jobs index, it is
+// opaque to callers but checked against their auth-name
+type jobsNext struct {
+	ID        string `json:"id"`
+	AuthName  string `json:"auth-name"`
+	Submitted int64  `json:"submitted"`
+}
+
+func encodeJobsNext(record *rce.JobRecord) string {
+	data, err := json.Marshal(jobsNext{
+		ID:        record.ID,
+		AuthName:  record.AuthName,
+		Submitted: record.Submitted,
+	})
+	if err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// next from the last evaluated key of a query of the jobs index
+func encodeJobsNextKey(key map[string]*dynamodb.AttributeValue) string {
+	next := jobsNext{}
+	err := dynamodbattribute.UnmarshalMap(key, &next)
+	if err != nil {
+		panic(err)
+	}
+	data, err := json.Marshal(next)
+	if err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// a filtered query may read many jobs per match, so it reads larger
+// pages, and stops once it has read for jobsQueryBudget, well inside
+// the 29s api gateway timeout, returning the matches so far with next
+// set. a caller can get a page with fewer than limit jobs, or none,
+// and still have next.
+const (
+	jobsQueryPageSize = 200
+	jobsQueryBudget   = 10 * time.Second
+)
+
+func decodeJobsNext(next, authName string) (map[string]*dynamodb.AttributeValue, error) {
+	if next == "" {
+		return nil, nil
+	}
+	data, err := base64.RawURLEncoding.DecodeString(next)
+	if err != nil {
+		return nil, fmt.Errorf("bad next: %s", next)
+	}
+	key := jobsNext{}
+	err = json.Unmarshal(data, &key)
+	if err != nil || key.AuthName != authName {
+		return nil, fmt.Errorf("bad next: %s", next)
+	}
+	return dynamodbattribute.MarshalMap(key)
+}
+
+// jobs are queried newest first from the jobs index, which is keyed by
+// auth-name and submitted, then filtered on their status.
+func httpJobsGet(ctx context.Context, event *events.APIGatewayProxyRequest, res chan<- events.APIGatewayProxyResponse, authName string) {
+	query, err := rce.ParseJobsQuery(event.QueryStringParameters)
+	if err != nil {
+		res <- badRequest(ctx, err)
+		return
+	}
+	jobsResp, err := queryJobs(ctx, authName, query)
+	if err != nil {
+		res <- badRequest(ctx, err)
+		return
+	}
+	data, err := json.Marshal(jobsResp)
+	if err != nil {
+		panic(err)
+	}
+	res <- events.APIGatewayProxyResponse{
+		StatusCode: 200,
+		Body:       string(data),
+		Headers: map[string]string{
+			"auth-name":    authName,
+			"Content-Type": "application/json",
+		},
+	}
+}
+
+// query the jobs index newest first, filtering by query. errors are
+// from a bad next.
+func queryJobs(ctx context.Context, authName string, query rce.JobsQuery) (*rce.JobsGetResponse, error) {
+	start, err := decodeJobsNext(query.Next, authName)
+	if err != nil {
+		return nil, err
+	}
+	until := int64(math.MaxInt64)
+	if !query.Until.IsZero() {
+		until = query.Until.UnixNano() / 1e6
+	}
+	var since int64
+	if !query.Since.IsZero() {
+		since = query.Since.UnixNano() / 1e6
+	}
+	jobsResp := &rce.JobsGetResponse{
+		Jobs: []rce.JobStatus{},
+	}
+	pageSize := query.Limit
+	if query.Filtered() {
+		pageSize = jobsQueryPageSize
+	}
+	deadline := time.Now().Add(jobsQueryBudget)
+outer:
+	for {
+		var out *dynamodb.QueryOutput
+		err := lib.Retry(ctx, func() error {
+			var err error
+			out, err = lib.DynamoDBClient().QueryWithContext(ctx, &dynamodb.QueryInput{
+				TableName:              aws.String(os.Getenv("PROJECT_NAME")),
+				IndexName:              aws.String(rce.JobsIndex),
+				KeyConditionExpression: aws.String("#a = :a AND #s BETWEEN :since AND :until"),
+				ExpressionAttributeNames: map[string]*string{
+					"#a": aws.String("auth-name"),
+					"#s": aws.String("submitted"),
+				},
+				ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+					":a":     {S: aws.String(authName)},
+					":since": {N: aws.String(fmt.Sprint(since))},
+					":until": {N: aws.String(fmt.Sprint(until))},
+				},
+				ScanIndexForward:  aws.Bool(false),
+				ExclusiveStartKey: start,
+				Limit:             aws.Int64(int64(pageSize)),
+			})
+			return err
+		})
+		if err != nil {
+			panic(err)
+		}
+		for i, item := range out.Items {
+			record := &rce.JobRecord{}
+			err := dynamodbattribute.UnmarshalMap(item, record)
+			if err != nil {
+				panic(err)
+			}
+			status := record.Status()
+			if !query.Match(status) {
+				continue
+			}
+			jobsResp.Jobs = append(jobsResp.Jobs, *status)
+			if len(jobsResp.Jobs) == query.Limit {
+				if i+1 < len(out.Items) || out.LastEvaluatedKey != nil {
+					jobsResp.Next = encodeJobsNext(record)
+				}
+				break outer
+			}
+		}
+		if out.LastEvaluatedKey == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			jobsResp.Next = encodeJobsNextKey(out.LastEvaluatedKey)
+			break
+		}
+		start = out.LastEvaluatedKey
+	}
+	return jobsResp, nil
+}
+
+func httpUploadPost(_ context.Context, _ *events.APIGatewayProxyRequest, res chan<- events.APIGatewayProxyResponse, authName string) {
+	bucket := os.Getenv("PROJECT_BUCKET")
+	id := uuid.Must(uuid.NewV4()).String()
+	uploadKey := fmt.Sprintf("uploads/%s/%s", authName, id)
+	data, err := json.Marshal(rce.UploadPostResponse{
+		Id:  id,
+		Url: lib.S3PresignPut(bucket, uploadKey, rce.UploadUrlExpire),
+	})
+	if err != nil {
+		panic(err)
+	}
+	res <- events.APIGatewayProxyResponse{
+		StatusCode: 200,
+		Body:       string(data),
+		Headers: map[string]string{
+			"auth-name":    authName,
+			"Content-Type": "application/json",
+		},
+	}
+}
+
+func httpVersionGet(_ context.Context, _ *events.APIGatewayProxyRequest, res chan<- events.APIGatewayProxyResponse) {
+	val := map[string]string{}
+	err := filepath.Walk(".", func(file string, _ os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		info, err := os.Stat(file)
+		if err != nil {
+			panic(err)
+		}
+		if info.IsDir() {
+			return nil
+		}
+		data, err := os.ReadFile(file)
+		if err != nil {
+			panic(err)
+		}
+		hash := sha256.Sum256(data)
+		hashHex := hex.EncodeToString(hash[:])
+		size := humanize.Bytes(uint64(info.Size()))
+		val[file] = fmt.Sprintf("%s %s", hashHex, size)
+		return nil
+	})
+	if err != nil {
+		panic(err)
+	}
+	data, err := json.Marshal(val)
+	if err != nil {
+		panic(err)
+	}
+	res <- events.APIGatewayProxyResponse{
+		StatusCode: 200,
 		Body:       string(data),
 	}
 }
@@ -341,12 +2711,12 @@ func handleApiEvent(ctx context.Context, event *events.APIGatewayProxyRequest, r
 		}
 		auth, ok := rce.CaseInsensitiveGet(event.Headers, "auth")
 		if !ok {
-			res <- unauthorized()
+			res <- unauthorized(ctx)
 			return
 		}
 		authName, ok := checkAuth(ctx, auth)
 		if !ok {
-			res <- unauthorized()
+			res <- unauthorized(ctx)
 			return
 		}
 		switch event.Path {
@@ -358,45 +2728,517 @@ func handleApiEvent(ctx context.Context, event *events.APIGatewayProxyRequest, r
 			case http.MethodPost:
 				httpExecPost(ctx, event, res, authName)
 				return
-			default:
+			case http.MethodDelete:
+				httpExecDelete(ctx, event, res, authName)
+				return
+			default:
+			}
+		case "/api/exec/artifacts":
+			switch event.HTTPMethod {
+			case http.MethodGet:
+				httpExecArtifactsGet(ctx, event, res, authName)
+				return
+			default:
+			}
+		case "/api/exec/batch":
+			switch event.HTTPMethod {
+			case http.MethodPost:
+				httpExecBatchPost(ctx, event, res, authName)
+				return
+			default:
+			}
+		case "/api/exec/stream":
+			switch event.HTTPMethod {
+			case http.MethodGet:
+				httpExecStreamGet(ctx, event, res, authName)
+				return
+			default:
+			}
+		case "/api/exec/status":
+			switch event.HTTPMethod {
+			case http.MethodGet:
+				httpExecStatusGet(ctx, event, res, authName)
+				return
+			default:
+			}
+		case "/api/jobs":
+			switch event.HTTPMethod {
+			case http.MethodGet:
+				httpJobsGet(ctx, event, res, authName)
+				return
+			default:
+			}
+		case "/api/upload":
+			switch event.HTTPMethod {
+			case http.MethodPost:
+				httpUploadPost(ctx, event, res, authName)
+				return
+			default:
+			}
+		case "/api/webhook":
+			switch event.HTTPMethod {
+			case http.MethodGet:
+				httpWebhookGet(ctx, event, res, authName)
+				return
+			case http.MethodPut:
+				httpWebhookPut(ctx, event, res, authName)
+				return
+			case http.MethodDelete:
+				httpWebhookDelete(ctx, event, res, authName)
+				return
+			default:
+			}
+		case "/api/schedules":
+			switch event.HTTPMethod {
+			case http.MethodGet:
+				httpSchedulesGet(ctx, event, res, authName)
+				return
+			case http.MethodPost:
+				httpSchedulesPost(ctx, event, res, authName)
+				return
+			default:
+			}
+		default:
+			if strings.HasPrefix(event.Path, "/api/schedules/") {
+				switch event.HTTPMethod {
+				case http.MethodGet:
+					httpScheduleGet(ctx, event, res, authName)
+					return
+				case http.MethodDelete:
+					httpScheduleDelete(ctx, event, res, authName)
+					return
+				default:
+				}
+			}
+			if strings.HasPrefix(event.Path, "/api/groups/") {
+				switch event.HTTPMethod {
+				case http.MethodGet:
+					httpGroupGet(ctx, event, res, authName)
+					return
+				case http.MethodDelete:
+					httpGroupDelete(ctx, event, res, authName)
+					return
+				default:
+				}
+			}
+		}
+		res <- notfound(ctx)
+		return
+	}
+	res <- notfound(ctx)
+}
+
+func badRequest(ctx context.Context, err error) events.APIGatewayProxyResponse {
+	return errorResponse(ctx, 400, rce.CodeBadRequest, err.Error())
+}
+
+func atoi(x string) int {
+	n, err := strconv.Atoi(x)
+	if err != nil {
+		panic(err)
+	}
+	return n
+}
+
+func unauthorized(ctx context.Context) events.APIGatewayProxyResponse {
+	time.Sleep(1 * time.Second)
+	return errorResponse(ctx, 401, rce.CodeUnauthorized, "unauthorized")
+}
+
+// the panic and stack are logged, the caller only gets the request id
+func logRecover(ctx context.Context, r interface{}, res chan<- events.APIGatewayProxyResponse) {
+	stack := string(debug.Stack())
+	lib.Logger.Println("request-id:", requestId(ctx), r)
+	lib.Logger.Println(stack)
+	res <- errorResponse(ctx, 500, rce.CodeInternalError, "internal error")
+}
+
+func cancelRequested(ctx context.Context, bucket, cancelKey string) bool {
+	_, err := lib.S3Client().HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(cancelKey),
+	})
+	return err == nil
+}
+
+func s3Download(ctx context.Context, bucket, key, path string) {
+	err := lib.Retry(ctx, func() error {
+		out, err := lib.S3Client().GetObjectWithContext(ctx, &s3.GetObjectInput{
+			Bucket: aws.String(bucket),
+			Key:    aws.String(key),
+		})
+		if err != nil {
+			return err
+		}
+		defer func() { _ = out.Body.Close() }()
+		f, err := os.Create(path)
+		if err != nil {
+			panic(err)
+		}
+		_, err = io.Copy(f, out.Body)
+		if err != nil {
+			_ = f.Close()
+			return err
+		}
+		return f.Close()
+	})
+	if err != nil {
+		panic(err)
+	}
+}
+
+// the clean environment keeps only what is needed to find and run
+// programs, leaving out aws credentials and project configuration.
+func jobEnv(event *rce.ExecAsyncEvent) []string {
+	var env []string
+	if event.CleanEnv {
+		for _, k := range []string{"PATH", "LANG", "LD_LIBRARY_PATH", "TZ"} {
+			v, ok := os.LookupEnv(k)
+			if ok {
+				env = append(env, k+"="+v)
+			}
+		}
+		env = append(env, "HOME=/tmp", "TMPDIR=/tmp")
+	} else {
+		env = os.Environ()
+	}
+	var keys []string
+	for k := range event.Env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		env = append(env, k+"="+event.Env[k])
+	}
+	return env
+}
+
+// uploaded workspaces are unpacked into a per-job directory under here
+const jobsDir = "/tmp/jobs"
+
+// unpack the uploaded workspace, which becomes the working directory,
+// with a relative event.Dir resolved inside it.
+func prepareWorkspace(ctx context.Context, bucket string, event *rce.ExecAsyncEvent, cmd *exec.Cmd) error {
+	if event.Workspace == "" {
+		return nil
+	}
+	dir := filepath.Join(jobsDir, event.Uid)
+	out, err := lib.S3Client().GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(fmt.Sprintf("uploads/%s/%s", event.AuthName, event.Workspace)),
+	})
+	if err != nil {
+		return err
+	}
+	defer func() { _ = out.Body.Close() }()
+	err = rce.UntarWorkspace(out.Body, dir)
+	if err != nil {
+		return err
+	}
+	cmd.Dir = dir
+	if event.Dir != "" {
+		if filepath.IsAbs(event.Dir) {
+			cmd.Dir = event.Dir
+		} else {
+			cmd.Dir = filepath.Join(dir, event.Dir)
+		}
+	}
+	return nil
+}
+
+// upload files matching the artifact globs, directories are included
+// recursively. keys are relative to the working directory.
+func collectArtifacts(ctx context.Context, bucket string, event *rce.ExecAsyncEvent, dir string) {
+	if len(event.Artifacts) == 0 {
+		return
+	}
+	if dir == "" {
+		var err error
+		dir, err = os.Getwd()
+		if err != nil {
+			panic(err)
+		}
+	}
+	prefix := fmt.Sprintf("jobs/%s/%s/artifacts/", event.AuthName, event.Uid)
+	uploaded := map[string]bool{}
+	upload := func(path string) {
+		rel, err := filepath.Rel(dir, path)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			rel = strings.TrimLeft(path, "/")
+		}
+		rel = filepath.ToSlash(rel)
+		if uploaded[rel] {
+			return
+		}
+		uploaded[rel] = true
+		err = lib.Retry(ctx, func() error {
+			f, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+			defer func() { _ = f.Close() }()
+			_, err = lib.S3Client().PutObjectWithContext(ctx, &s3.PutObjectInput{
+				Bucket: aws.String(bucket),
+				Key:    aws.String(prefix + rel),
+				Body:   f,
+			})
+			return err
+		})
+		if err != nil {
+			lib.Logger.Println("error: artifact", path, err)
+		}
+	}
+	for _, pattern := range event.Artifacts {
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(dir, pattern)
+		}
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			lib.Logger.Println("error: artifact pattern", pattern, err)
+			continue
+		}
+		for _, match := range matches {
+			err := filepath.Walk(match, func(path string, info os.FileInfo, err error) error {
+				if err != nil {
+					return err
+				}
+				if info.Mode().IsRegular() {
+					upload(path)
+				}
+				return nil
+			})
+			if err != nil {
+				lib.Logger.Println("error: artifact", match, err)
+			}
+		}
+	}
+}
+
+// the exit code of a finished process, with death by signal reported
+// shell style as 128+N along with the signal name.
+func processExit(state *os.ProcessState) (int, string) {
+	if state == nil {
+		return 1, ""
+	}
+	status, ok := state.Sys().(syscall.WaitStatus)
+	if ok && status.Signaled() {
+		return 128 + int(status.Signal()), unix.SignalName(status.Signal())
+	}
+	return state.ExitCode(), ""
+}
+
+// time reserved before the lambda deadline to ship logs, artifacts, and exit
+const deadlineReserve = 60 * time.Second
+
+// the requested timeout, capped at rce.MaxTimeout and at what the lambda
+// deadline allows.
+func jobTimeout(ctx context.Context, event *rce.ExecAsyncEvent) time.Duration {
+	timeout := rce.MaxTimeout
+	if event.Timeout > 0 && time.Duration(event.Timeout)*time.Second < timeout {
+		timeout = time.Duration(event.Timeout) * time.Second
+	}
+	deadline, ok := ctx.Deadline()
+	if ok && time.Until(deadline)-deadlineReserve < timeout {
+		timeout = time.Until(deadline) - deadlineReserve
+	}
+	return timeout
+}
+
+// signal the process group so children holding stdout/stderr open die too
+func signalGroup(cmd *exec.Cmd, sig syscall.Signal) {
+	if cmd.Process != nil {
+		_ = syscall.Kill(-cmd.Process.Pid, sig)
+	}
+}
+
+// chunks are numbered in order, their concatenation is the log
+func logChunkKey(authName, uid string, index int) string {
+	return fmt.Sprintf("jobs/%s/%s/log/%08d", authName, uid, index)
+}
+
+type logLine struct {
+	stream int
+	data   []byte
+}
+
+// in raw mode bytes are copied through unchanged, otherwise output is
+// read by line, empty lines are dropped, and every line ends in a newline.
+func readOutput(r io.Reader, stream int, raw bool, lines chan<- *logLine) {
+	if raw {
+		buf := make([]byte, 32*1024)
+		for {
+			n, err := r.Read(buf)
+			if n > 0 {
+				data := make([]byte, n)
+				copy(data, buf[:n])
+				lines <- &logLine{stream, data}
+			}
+			if err != nil {
+				lines <- nil
+				return
 			}
-		default:
 		}
-		res <- notfound()
-		return
 	}
-	res <- notfound()
+	readBuf := bufio.NewReader(r)
+	for {
+		line, err := readBuf.ReadString('\n')
+		if err != nil {
+			lines <- nil
+			return
+		}
+		line = strings.TrimRight(line, "\n")
+		if line != "" {
+			lines <- &logLine{stream, []byte(line + "\n")}
+		}
+	}
 }
 
-func atoi(x string) int {
-	n, err := strconv.Atoi(x)
-	if err != nil {
-		panic(err)
+// the heartbeat of a running job. the sweep marks a job lost once its
+// heartbeat is LostJobTimeout old, and then writes its last log chunk,
+// exit, and size. a lambda that was frozen past that must not overwrite
+// them, so once a heartbeat fails nothing more is written, and before
+// writing, an overdue heartbeat is renewed first.
+type jobHeartbeat struct {
+	uid   string
+	lock  sync.Mutex
+	last  time.Time
+	swept bool
+}
+
+// renew the heartbeat, conditional on the job being active. returns
+// false once the job was swept as lost.
+func (h *jobHeartbeat) beat(ctx context.Context) bool {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if h.swept {
+		return false
 	}
-	return n
+	now := time.Now()
+	if !updateJobRecord(ctx, h.uid, map[string]interface{}{
+		"heartbeat": now.UnixNano() / 1e6,
+	}) {
+		lib.Logger.Println("job was swept as lost:", h.uid)
+		h.swept = true
+		return false
+	}
+	h.last = now
+	return true
 }
 
-func unauthorized() events.APIGatewayProxyResponse {
-	time.Sleep(1 * time.Second)
-	return events.APIGatewayProxyResponse{
-		StatusCode: 401,
+// whether the job may still write its log and exit, renewing an overdue
+// heartbeat first
+func (h *jobHeartbeat) alive(ctx context.Context) bool {
+	h.lock.Lock()
+	overdue := time.Since(h.last) > 2*rce.HeartbeatInterval
+	ok := !h.swept
+	h.lock.Unlock()
+	if ok && overdue {
+		return h.beat(ctx)
 	}
+	return ok
 }
 
-func logRecover(r interface{}, res chan<- events.APIGatewayProxyResponse) {
-	stack := string(debug.Stack())
-	lib.Logger.Println(r)
-	lib.Logger.Println(stack)
+// renew the heartbeat every HeartbeatInterval until done is closed or
+// the job is swept
+func (h *jobHeartbeat) run(ctx context.Context, done <-chan struct{}, res chan<- events.APIGatewayProxyResponse) {
+	defer func() {
+		if r := recover(); r != nil {
+			logRecover(ctx, r, res)
+		}
+	}()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ctx.Done():
+			return
+		case <-time.After(rce.HeartbeatInterval):
+			if !h.beat(ctx) {
+				return
+			}
+		}
+	}
+}
+
+func asyncRespond(res chan<- events.APIGatewayProxyResponse, event *rce.ExecAsyncEvent) {
 	res <- events.APIGatewayProxyResponse{
-		StatusCode: 500,
-		Body:       fmt.Sprint(r) + "\n" + stack,
+		Body:       "ok",
+		StatusCode: 200,
+		Headers: map[string]string{
+			"auth-name": event.AuthName,
+			"uid":       event.Uid,
+		},
 	}
 }
 
+// run a job: start the heartbeat, run the command while shipping its
+// log, then write its exit and size, update its record, and post its
+// webhook. each write after the run is skipped once the job was swept
+// as lost.
 func handleAsyncEvent(ctx context.Context, event *rce.ExecAsyncEvent, res chan<- events.APIGatewayProxyResponse) {
 	bucket := os.Getenv("PROJECT_BUCKET")
 	start := time.Now()
+	// lambda retries an async event after a crash, by then the job is
+	// running or was marked lost, so it is not run twice
+	if !startJobRecord(ctx, event.Uid, start) {
+		lib.Logger.Println("job already started:", event.Uid)
+		asyncRespond(res, event)
+		return
+	}
+	heartbeat := &jobHeartbeat{uid: event.Uid, last: start}
+	heartbeatDone := make(chan struct{})
+	defer close(heartbeatDone)
+	go heartbeat.run(ctx, heartbeatDone, res)
+	// lambda reuses /tmp between invocations, clear anything left by a previous job
+	_ = os.RemoveAll(jobsDir)
+	defer func() { _ = os.RemoveAll(jobsDir) }()
+	exitStatus, logSize := runJob(ctx, bucket, event, start, heartbeat, res)
+	if !heartbeat.alive(ctx) {
+		asyncRespond(res, event)
+		return
+	}
+	writeJobExit(ctx, bucket, event, exitStatus, logSize)
+	if finishJobRecord(ctx, event.Uid, exitStatus, logSize) {
+		if event.Webhook != "" {
+			invokeWebhook(ctx, event.Uid)
+		}
+	} else {
+		lib.Logger.Println("job was swept as lost or its record is missing:", event.Uid)
+	}
+	asyncRespond(res, event)
+}
+
+// the command of a job, with its env, dir, and stdin. the returned func
+// removes the stdin downloaded for it.
+func jobCmd(ctx context.Context, bucket string, event *rce.ExecAsyncEvent) (*exec.Cmd, func()) {
 	cmd := exec.CommandContext(ctx, event.Argv[0], event.Argv[1:]...)
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Env = jobEnv(event)
+	cmd.Dir = event.Dir
+	cleanup := func() {}
+	if event.StdinUpload != "" {
+		stdinPath := "/tmp/stdin"
+		s3Download(ctx, bucket, fmt.Sprintf("uploads/%s/%s", event.AuthName, event.StdinUpload), stdinPath)
+		stdinFile, err := os.Open(stdinPath)
+		if err != nil {
+			panic(err)
+		}
+		cmd.Stdin = stdinFile
+		cleanup = func() {
+			_ = stdinFile.Close()
+			_ = os.Remove(stdinPath)
+		}
+	} else if len(event.Stdin) > 0 {
+		cmd.Stdin = bytes.NewReader(event.Stdin)
+	}
+	return cmd, cleanup
+}
+
+// run the command of a job, shipping its log until it exits and its
+// artifacts are collected. returns its exit status and log size.
+func runJob(ctx context.Context, bucket string, event *rce.ExecAsyncEvent, start time.Time, heartbeat *jobHeartbeat, res chan<- events.APIGatewayProxyResponse) (rce.ExitStatus, int) {
+	cmd, cleanup := jobCmd(ctx, bucket, event)
+	defer cleanup()
 	stdout, err := cmd.StdoutPipe()
 	if err != nil {
 		panic(err)
@@ -405,222 +3247,242 @@ func handleAsyncEvent(ctx context.Context, event *rce.ExecAsyncEvent, res chan<-
 	if err != nil {
 		panic(err)
 	}
-	lines := make(chan *string, 128)
+	lines := make(chan *logLine, 128)
+	exited := make(chan struct{})
+	cancelled, timedOut := watchJob(ctx, bucket, event, cmd, start, lines, exited)
+	logsDone := make(chan int)
+	go writeJobLog(ctx, bucket, event, heartbeat, lines, logsDone, res)
+	exitStatus := rce.ExitStatus{}
+	var logSize int
+	err = prepareWorkspace(ctx, bucket, event, cmd)
+	if err == nil {
+		err = cmd.Start()
+	}
+	if err != nil {
+		lib.Logger.Println("error:", err)
+		// nothing started so there are no readers, log the error and finish the log
+		lines <- &logLine{rce.Stderr, []byte(fmt.Sprint("error: ", err, "\n"))}
+		lines <- nil
+		lines <- nil
+		logSize = <-logsDone
+		exitStatus.Exit = 1
+	} else {
+		for stream, r := range map[int]io.ReadCloser{rce.Stdout: stdout, rce.Stderr: stderr} {
+			stream, r := stream, r
+			go func() {
+				// defer func() {}()
+				readOutput(r, stream, event.Raw, lines)
+			}()
+		}
+		logSize = <-logsDone
+		err = cmd.Wait()
+		if err != nil {
+			lib.Logger.Println("wait:", err)
+		}
+		exitStatus.Exit, exitStatus.Signal = processExit(cmd.ProcessState)
+	}
+	close(exited)
+	// artifacts are uploaded before exit is written, so they are ready once the caller sees exit
+	collectArtifacts(ctx, bucket, event, cmd.Dir)
+	select {
+	case <-cancelled:
+		exitStatus.Reason = rce.ExitReasonCancelled
+	case <-timedOut:
+		exitStatus.Exit = rce.ExitTimeout
+		exitStatus.Reason = rce.ExitReasonTimeout
+	default:
+	}
+	return exitStatus, logSize
+}
+
+// stop the command, with a last log line, once the job times out or a
+// cancel is requested, closing the returned cancelled or timed out
+// channel. returns once the command has exited.
+func watchJob(ctx context.Context, bucket string, event *rce.ExecAsyncEvent, cmd *exec.Cmd, start time.Time, lines chan<- *logLine, exited <-chan struct{}) (<-chan struct{}, <-chan struct{}) {
+	cancelled := make(chan struct{})
+	timedOut := make(chan struct{})
+	timeout := jobTimeout(ctx, event)
 	go func() {
 		// defer func() {}()
+		stop := func() {
+			signalGroup(cmd, syscall.SIGTERM)
+			select {
+			case <-ctx.Done():
+			case <-exited:
+			case <-time.After(rce.CancelGracePeriod):
+				signalGroup(cmd, syscall.SIGKILL)
+			}
+		}
+		cancelKey := fmt.Sprintf("jobs/%s/%s/cancel", event.AuthName, event.Uid)
+		lastCancelCheck := time.Now()
 		for {
-			if time.Since(start) > 14*time.Minute {
-				lines <- aws.String("timeout after 14 minutes")
-				_ = cmd.Process.Signal(syscall.SIGKILL)
+			if time.Since(start) > timeout {
+				lines <- &logLine{rce.Stderr, []byte(fmt.Sprintf("timeout after %s\n", timeout))}
+				close(timedOut)
+				stop()
 				return
 			}
+			if time.Since(lastCancelCheck) > rce.LogShipInterval {
+				lastCancelCheck = time.Now()
+				if cancelRequested(ctx, bucket, cancelKey) {
+					lines <- &logLine{rce.Stderr, []byte("cancelled\n")}
+					close(cancelled)
+					stop()
+					return
+				}
+			}
 			select {
 			case <-ctx.Done():
 				return
-			default:
-				time.Sleep(1 * time.Second)
+			case <-exited:
+				return
+			case <-time.After(1 * time.Second):
 			}
 		}
 	}()
-	for _, r := range []io.ReadCloser{stdout, stderr} {
-		r := r
-		go func() {
-			// defer func() {}()
-			readBuf := bufio.NewReader(r)
-			for {
-				line, err := readBuf.ReadString('\n')
-				if err != nil {
-					lines <- nil
-					return
-				}
-				line = strings.TrimRight(line, "\n")
-				lines <- &line
-			}
-		}()
-	}
-	logsDone := make(chan error)
+	return cancelled, timedOut
+}
+
+// write lines to the log file as frames, shipping it every
+// LogShipInterval, or early once a chunk is MaxLogChunkBytes, and
+// nothing once the job was swept as lost. after a nil line from each
+// stream, ships the rest and sends the log size on done.
+func writeJobLog(ctx context.Context, bucket string, event *rce.ExecAsyncEvent, heartbeat *jobHeartbeat, lines <-chan *logLine, done chan<- int, res chan<- events.APIGatewayProxyResponse) {
+	defer func() {
+		if r := recover(); r != nil {
+			logRecover(ctx, r, res)
+		}
+	}()
+	logToDisk := true
+	doneCount := 0
+	lastShippedTime := time.Now()
+	lastShippedSize := 0
 	logFileSize := 0
-	go func() {
-		defer func() {
-			if r := recover(); r != nil {
-				logRecover(r, res)
+	maxLogBytes := rce.MaxLogBytes
+	if event.PushUrls != nil {
+		maxLogBytes = rce.MaxPushLogBytes
+	}
+	// when pushing, the log file holds the entire log. otherwise it
+	// holds only the bytes not yet shipped, which become the next chunk.
+	chunkIndex := 0
+	logFilePath := "/tmp/log.txt"
+	_ = os.Remove(logFilePath)
+	logFile, err := os.Create(logFilePath)
+	if err != nil {
+		panic(err)
+	}
+	logFileWriter := bufio.NewWriter(logFile)
+	shipLogs := func() {
+		err := logFileWriter.Flush()
+		if err != nil {
+			panic(err)
+		}
+		err = logFile.Sync()
+		if err != nil {
+			panic(err)
+		}
+		size := logFileSize - lastShippedSize
+		if event.PushUrls != nil {
+			size = logFileSize
+		}
+		if lastShippedSize == logFileSize || !heartbeat.alive(ctx) {
+			lastShippedTime = time.Now()
+			return
+		}
+		putJobLog(ctx, bucket, event, logFilePath, size, chunkIndex, res)
+		if event.PushUrls == nil {
+			chunkIndex++
+			err = logFile.Truncate(0)
+			if err != nil {
+				panic(err)
 			}
-		}()
-		logToDisk := true
-		doneCount := 0
-		lastShippedTime := time.Now()
-		lastShippedSize := 0
-		logKey := fmt.Sprintf("jobs/%s/%s/log.txt", event.AuthName, event.Uid)
-		logLock := &sync.RWMutex{}
-		logFilePath := "/tmp/log.txt"
-		_ = os.Remove(logFilePath)
-		logFile, err := os.Create(logFilePath)
-		if err != nil {
-			panic(err)
-		}
-		logFileWriter := bufio.NewWriter(logFile)
-		shipLogs := func() {
-			err = lib.Retry(ctx, func() error {
-				logLock.Lock()
-				err := logFileWriter.Flush()
-				if err != nil {
-					panic(err)
-				}
-				err = logFile.Sync()
-				if err != nil {
-					panic(err)
-				}
-				logLock.Unlock()
-				r, err := os.Open(logFilePath)
-				if err != nil {
-					panic(err)
-				}
-				defer func() {
-					err := r.Close()
+			_, err = logFile.Seek(0, io.SeekStart)
+			if err != nil {
+				panic(err)
+			}
+		}
+		lastShippedSize = logFileSize
+		lastShippedTime = time.Now()
+	}
+	for {
+		select {
+		case line := <-lines:
+			if line == nil {
+				doneCount++
+				if doneCount == 2 {
+					shipLogs()
+					err := logFile.Close()
 					if err != nil {
 						panic(err)
 					}
-				}()
-				fi, err := r.Stat()
-				if err != nil {
-					panic(err)
-				}
-				size := int(fi.Size())
-				if lastShippedSize == size {
-					return nil
+					done <- logFileSize
+					return
 				}
-				lastShippedSize = size
-				if event.PushUrls != nil {
-					pr, pw := io.Pipe()
-					errChan := make(chan error)
-					go func() {
-						defer func() {
-							if r := recover(); r != nil {
-								logRecover(r, res)
-							}
-						}()
-						_, copyErr := io.CopyN(pw, r, int64(size))
-						err = pw.Close()
+			} else {
+				frame := rce.EncodeFrame(line.stream, line.data)
+				if logFileSize >= maxLogBytes {
+					if logToDisk {
+						frame = rce.EncodeFrame(rce.Stderr, []byte("[log truncated]\n"))
+						_, err = logFileWriter.Write(frame)
 						if err != nil {
 							panic(err)
 						}
-						errChan <- copyErr
-					}()
-					putReq, err := http.NewRequest(http.MethodPut, event.PushUrls.Log, pr)
-					if err != nil {
-						panic(err)
-					}
-					putReq.ContentLength = int64(size)
-					resp, err := http.DefaultClient.Do(putReq)
-					if err != nil {
-						return err
-					}
-					_, _ = io.ReadAll(resp.Body)
-					_ = resp.Body.Close()
-					if resp.StatusCode != 200 {
-						return fmt.Errorf("expected 200, got: %d", resp.StatusCode)
+						logFileSize += len(frame)
+						logToDisk = false
 					}
-					err = <-errChan
+				} else {
+					_, err = logFileWriter.Write(frame)
 					if err != nil {
 						panic(err)
 					}
-					return nil
+					logFileSize += len(frame)
 				}
-				_, err = lib.S3Client().PutObject(&s3.PutObjectInput{
-					Bucket: aws.String(bucket),
-					Key:    aws.String(logKey),
-					Body:   r,
-				})
-				return err
-			})
-			if err != nil {
-				panic(err)
 			}
-			lastShippedTime = time.Now()
+		case <-time.After(rce.LogShipInterval):
+			// check if logs need to be shipped even when no new output
 		}
-		for {
-			select {
-			case line := <-lines:
-				if line == nil {
-					doneCount++
-					if doneCount == 2 {
-						shipLogs()
-						err := logFile.Close()
-						if err != nil {
-							panic(err)
-						}
-						logsDone <- nil
-						return
-					}
-				} else if *line != "" {
-					logLock.Lock()
-					val := *line + "\n"
-					if logFileSize >= rce.MaxLogBytes {
-						if logToDisk {
-							_, err = logFileWriter.WriteString("[log truncated]\n")
-							if err != nil {
-								panic(err)
-							}
-							logToDisk = false
-						}
-					} else {
-						_, err = logFileWriter.WriteString(val)
-						if err != nil {
-							panic(err)
-						}
-						logFileSize += len(val)
-					}
-					logLock.Unlock()
-				}
-			case <-time.After(rce.LogShipInterval):
-				// check if logs need to be shipped even when no new output
-			}
-			if time.Since(lastShippedTime) > rce.LogShipInterval {
-				shipLogs()
-			}
+		if time.Since(lastShippedTime) > rce.LogShipInterval ||
+			(event.PushUrls == nil && logFileSize-lastShippedSize >= rce.MaxLogChunkBytes) {
+			shipLogs()
 		}
-	}()
-	exitCode := 0
-	err = cmd.Start()
-	if err != nil {
-		lib.Logger.Println("error:", err)
-		exitCode = 1
-	} else {
-		<-logsDone
-		err = cmd.Wait()
+	}
+}
+
+// put the first size bytes of the log file to the log push url, or
+// else to s3 as the chunk at chunkIndex
+func putJobLog(ctx context.Context, bucket string, event *rce.ExecAsyncEvent, logFilePath string, size, chunkIndex int, res chan<- events.APIGatewayProxyResponse) {
+	err := lib.Retry(ctx, func() error {
+		r, err := os.Open(logFilePath)
 		if err != nil {
-			exitCode = 1
+			panic(err)
 		}
-	}
-	if event.PushUrls != nil {
-		err := lib.Retry(ctx, func() error {
-			payload := []byte(fmt.Sprint(exitCode))
-			putReq, err := http.NewRequest(http.MethodPut, event.PushUrls.Exit, bytes.NewReader(payload))
+		defer func() {
+			err := r.Close()
 			if err != nil {
 				panic(err)
 			}
-			putReq.ContentLength = int64(len(payload))
-			resp, err := http.DefaultClient.Do(putReq)
-			if err != nil {
-				return err
-			}
-			_, _ = io.ReadAll(resp.Body)
-			_ = resp.Body.Close()
-			if resp.StatusCode != 200 {
-				return fmt.Errorf("expected 200, got: %d", resp.StatusCode)
-			}
-			return nil
-		})
-		if err != nil {
-			panic(err)
-		}
-		err = lib.Retry(ctx, func() error {
-			payload := []byte(fmt.Sprint(logFileSize))
-			putReq, err := http.NewRequest(http.MethodPut, event.PushUrls.Size, bytes.NewReader(payload))
+		}()
+		if event.PushUrls != nil {
+			pr, pw := io.Pipe()
+			errChan := make(chan error)
+			go func() {
+				defer func() {
+					if r := recover(); r != nil {
+						logRecover(ctx, r, res)
+					}
+				}()
+				_, copyErr := io.CopyN(pw, r, int64(size))
+				err := pw.Close()
+				if err != nil {
+					panic(err)
+				}
+				errChan <- copyErr
+			}()
+			putReq, err := http.NewRequest(http.MethodPut, event.PushUrls.Log, pr)
 			if err != nil {
 				panic(err)
 			}
-			putReq.ContentLength = int64(len(payload))
+			putReq.ContentLength = int64(size)
 			resp, err := http.DefaultClient.Do(putReq)
 			if err != nil {
 				return err
@@ -630,51 +3492,111 @@ func handleAsyncEvent(ctx context.Context, event *rce.ExecAsyncEvent, res chan<-
 			if resp.StatusCode != 200 {
 				return fmt.Errorf("expected 200, got: %d", resp.StatusCode)
 			}
+			err = <-errChan
+			if err != nil {
+				panic(err)
+			}
 			return nil
-		})
-		if err != nil {
-			panic(err)
 		}
-	} else {
-		exitKey := fmt.Sprintf("jobs/%s/%s/exit", event.AuthName, event.Uid)
-		err = lib.Retry(ctx, func() error {
+		_, err = lib.S3Client().PutObject(&s3.PutObjectInput{
+			Bucket: aws.String(bucket),
+			Key:    aws.String(logChunkKey(event.AuthName, event.Uid, chunkIndex)),
+			Body:   io.NewSectionReader(r, 0, int64(size)),
+		})
+		return err
+	})
+	if err != nil {
+		panic(err)
+	}
+}
+
+// write the exit and then the size of a job, to its push urls or else
+// to s3. callers follow the log until exit and size are both present.
+func writeJobExit(ctx context.Context, bucket string, event *rce.ExecAsyncEvent, exitStatus rce.ExitStatus, logSize int) {
+	exitData, err := json.Marshal(exitStatus)
+	if err != nil {
+		panic(err)
+	}
+	sizeData := []byte(fmt.Sprint(logSize))
+	if event.PushUrls != nil {
+		pushPut(ctx, event.PushUrls.Exit, exitData)
+		pushPut(ctx, event.PushUrls.Size, sizeData)
+		return
+	}
+	for _, obj := range []struct {
+		key  string
+		data []byte
+	}{
+		{fmt.Sprintf("jobs/%s/%s/exit", event.AuthName, event.Uid), exitData},
+		{fmt.Sprintf("jobs/%s/%s/size", event.AuthName, event.Uid), sizeData},
+	} {
+		obj := obj
+		err := lib.Retry(ctx, func() error {
 			_, err := lib.S3Client().PutObject(&s3.PutObjectInput{
 				Bucket: aws.String(bucket),
-				Key:    aws.String(exitKey),
-				Body:   bytes.NewReader([]byte(fmt.Sprint(exitCode))),
+				Key:    aws.String(obj.key),
+				Body:   bytes.NewReader(obj.data),
 			})
 			return err
 		})
 		if err != nil {
 			panic(err)
 		}
-		sizeKey := fmt.Sprintf("jobs/%s/%s/size", event.AuthName, event.Uid)
-		err = lib.Retry(ctx, func() error {
-			_, err := lib.S3Client().PutObject(&s3.PutObjectInput{
-				Bucket: aws.String(bucket),
-				Key:    aws.String(sizeKey),
-				Body:   bytes.NewReader([]byte(fmt.Sprint(logFileSize))),
-			})
-			return err
-		})
+	}
+}
+
+func pushPut(ctx context.Context, url string, payload []byte) {
+	err := lib.Retry(ctx, func() error {
+		putReq, err := http.NewRequest(http.MethodPut, url, bytes.NewReader(payload))
 		if err != nil {
 			panic(err)
 		}
+		putReq.ContentLength = int64(len(payload))
+		resp, err := http.DefaultClient.Do(putReq)
+		if err != nil {
+			return err
+		}
+		_, _ = io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		if resp.StatusCode != 200 {
+			return fmt.Errorf("expected 200, got: %d", resp.StatusCode)
+		}
+		return nil
+	})
+	if err != nil {
+		panic(err)
 	}
-	res <- events.APIGatewayProxyResponse{
-		Body:       "ok",
-		StatusCode: 200,
-		Headers: map[string]string{
-			"auth-name": event.AuthName,
-			"uid":       event.Uid,
-		},
+}
+
+// the record is updated last, so a finished job has its logs and exit
+// in place. conditional on the job being active, so a sweep that
+// claimed it after the last heartbeat keeps its lost exit, and its
+// webhook. returns false if it was swept.
+func finishJobRecord(ctx context.Context, uid string, exitStatus rce.ExitStatus, logSize int) bool {
+	state := rce.StateFinished
+	if exitStatus.Exit != 0 {
+		state = rce.StateFailed
+	}
+	attrs := map[string]interface{}{
+		"state":    state,
+		"ended":    time.Now().UnixNano() / 1e6,
+		"exit":     exitStatus.Exit,
+		"log-size": logSize,
+		"active":   nil,
+	}
+	if exitStatus.Signal != "" {
+		attrs["signal"] = exitStatus.Signal
+	}
+	if exitStatus.Reason != "" {
+		attrs["reason"] = exitStatus.Reason
 	}
+	return updateJobRecord(ctx, uid, attrs)
 }
 
 func handle(ctx context.Context, event map[string]interface{}, res chan<- events.APIGatewayProxyResponse) {
 	defer func() {
 		if r := recover(); r != nil {
-			logRecover(r, res)
+			logRecover(ctx, r, res)
 		}
 	}()
 	if event["event-type"] == rce.EventExec {
@@ -690,9 +3612,27 @@ func handle(ctx context.Context, event map[string]interface{}, res chan<- events
 		handleAsyncEvent(ctx, asyncEvent, res)
 		return
 	}
-	_, ok := event["path"]
+	if event["event-type"] == rce.EventWebhook {
+		webhookEvent := &rce.WebhookAsyncEvent{}
+		data, err := json.Marshal(event)
+		if err != nil {
+			panic(err)
+		}
+		err = json.Unmarshal(data, &webhookEvent)
+		if err != nil {
+			panic(err)
+		}
+		handleWebhookEvent(ctx, webhookEvent, res)
+		return
+	}
+	_, ok := event["detail-type"].(string) // aws scheduled event
+	if ok {
+		handleScheduledEvent(ctx, res)
+		return
+	}
+	_, ok = event["path"]
 	if !ok {
-		res <- notfound()
+		res <- notfound(ctx)
 		return
 	}
 	apiEvent := &events.APIGatewayProxyRequest{}
@@ -729,7 +3669,7 @@ func handleRequest(ctx context.Context, event map[string]interface{}) (events.AP
 			authName = "-"
 		}
 		ip := event["requestContext"].(map[string]interface{})["identity"].(map[string]interface{})["sourceIp"].(string)
-		lib.Logger.Println("http", r.StatusCode, path, authName, uid, time.Since(start), ip, timestamp())
+		lib.Logger.Println("http", r.StatusCode, path, authName, uid, time.Since(start), ip, requestId(ctx), timestamp())
 	} else {
 		uid, ok := event["Uid"].(string)
 		if !ok {
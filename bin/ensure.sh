@@ -23,3 +23,5 @@ if [ -z "${NOJS:-}" ]; then
 fi
 
 libaws infra-ensure infra.yaml 2>&1 | sed 's/^/libaws: /'
+
+bash bin/cli.sh jobs-ttl-ensure 2>&1 | sed 's/^/ttl: /'
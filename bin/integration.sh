@@ -0,0 +1,45 @@
+#!/bin/bash
+set -eou pipefail
+#
+# checks against the deployed service, run after bin/ensure.sh with AUTH
+# set. these exercise the lambda's iam policy, which go test cannot.
+#
+
+source env.sh
+
+cli() {
+    bash bin/cli.sh "$@"
+}
+
+fail() {
+    echo "fail: $*" 1>&2
+    exit 1
+}
+
+echo check exec reads the log back
+out=$(cli exec --no-stdin -- sh -c 'echo out; echo err 1>&2' 2>&1)
+[ "$out" = "$(printf 'out\nerr')" ] || fail "exec output: $out"
+
+echo check a log of several chunks reads back
+out=$(cli exec --no-stdin -- sh -c 'for i in $(seq 1 5); do echo $i; sleep 4; done')
+[ "$out" = "$(seq 1 5)" ] || fail "chunked output: $out"
+
+echo check logs and wait of a detached job
+uid=$(cli exec --no-stdin --detach -- sh -c 'echo detached; exit 3')
+code=0
+cli wait $uid || code=$?
+[ $code = 3 ] || fail "wait exit: $code"
+out=$(cli logs $uid)
+[ "$out" = detached ] || fail "logs output: $out"
+
+echo check the stream reads the log back
+out=$(cli exec --no-stdin --stream -- echo streamed)
+[ "$out" = streamed ] || fail "stream output: $out"
+
+echo check artifacts are listed and downloaded
+dir=$(mktemp -d)
+trap "rm -rf $dir" EXIT
+cli exec --no-stdin --cwd /tmp --artifact 'rce-integration-*.txt' --download $dir -- sh -c 'echo a > rce-integration-a.txt; echo b > rce-integration-b.txt'
+[ "$(cat $dir/rce-integration-a.txt $dir/rce-integration-b.txt)" = "$(printf 'a\nb')" ] || fail "artifacts: $(ls $dir)"
+
+echo ok
@@ -0,0 +1,58 @@
+package cli
+
+import (
+	"errors"
+	"os"
+	"strings"
+
+	"github.com/nathants/aws-rce/rce"
+	"github.com/nathants/libaws/lib"
+)
+
+// api errors exit with codes from sysexits.h, so callers can tell them
+// apart from each other, though not from the exit code of the remote
+// command, which is passed through.
+const (
+	exitBadRequest   = 64 // EX_USAGE
+	exitNotFound     = 66 // EX_NOINPUT
+	exitRateLimited  = 75 // EX_TEMPFAIL
+	exitConflict     = 75 // EX_TEMPFAIL
+	exitNoHeartbeat  = 75 // EX_TEMPFAIL
+	exitUnauthorized = 77 // EX_NOPERM
+)
+
+// log the error and exit with its code. api errors and a lost heartbeat
+// exit with codes from sysexits.h, other errors exit 1.
+func Fatal(err error) {
+	var apiErr *rce.APIError
+	switch {
+	case errors.Is(err, rce.ErrUnauthorized):
+		lib.Logger.Println("error: unauthorized, check that AUTH is set and valid")
+		os.Exit(exitUnauthorized)
+	case errors.Is(err, rce.ErrBadRequest) && errors.As(err, &apiErr):
+		msg := apiErr.Message
+		if msg == "" {
+			msg = strings.TrimSpace(apiErr.Body)
+		}
+		lib.Logger.Println("error: bad request:", msg)
+		os.Exit(exitBadRequest)
+	case errors.Is(err, rce.ErrNotFound):
+		lib.Logger.Println("error: not found")
+		os.Exit(exitNotFound)
+	case errors.Is(err, rce.ErrRateLimited) && errors.As(err, &apiErr):
+		if apiErr.RetryAfter != 0 {
+			lib.Logger.Println("error: rate limited, retry after", apiErr.RetryAfter)
+		} else {
+			lib.Logger.Println("error: rate limited, retry later")
+		}
+		os.Exit(exitRateLimited)
+	case errors.Is(err, rce.ErrConflict):
+		lib.Logger.Println("error: a request with this idempotency key is in progress, retry later")
+		os.Exit(exitConflict)
+	case errors.Is(err, rce.ErrNoHeartbeat):
+		lib.Logger.Println("error:", err)
+		os.Exit(exitNoHeartbeat)
+	default:
+		lib.Logger.Fatal("error: ", err)
+	}
+}
@@ -2,10 +2,16 @@ package awsrce
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"math"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/alexflint/go-arg"
+	"github.com/nathants/aws-rce/cmd/cli"
 	"github.com/nathants/aws-rce/rce"
 	"github.com/nathants/libaws/lib"
 )
@@ -16,11 +22,26 @@ func init() {
 }
 
 type execArgs struct {
-	Argv []string `arg:"positional,required"`
+	NoStdin   bool          `arg:"--no-stdin" help:"do not send stdin even when it is a pipe or file, for a pipe that never closes"`
+	Env       []string      `arg:"--env,separate" help:"KEY=VAL, may be repeated"`
+	EnvFile   []string      `arg:"--env-file,separate" help:"file of KEY=VAL lines, may be repeated"`
+	Cwd       string        `arg:"--cwd" help:"working directory of the remote command"`
+	CleanEnv  bool          `arg:"--clean-env" help:"do not inherit the lambda environment"`
+	Upload    string        `arg:"--upload" help:"directory to upload as the working directory, honors .rceignore"`
+	Artifact  []string      `arg:"--artifact,separate" help:"glob relative to the working directory to collect after exit, may be repeated"`
+	Download  string        `arg:"--download" help:"directory to download artifacts into after exit"`
+	Raw       bool          `arg:"--raw" help:"copy output bytes unchanged, keeping blank lines and a missing final newline"`
+	Timeout   time.Duration `arg:"--timeout" help:"kill the remote command after this long and exit 124, like 30s or 5m, at most 14m"`
+	Detach    bool          `arg:"--detach" help:"print the uid and exit without waiting, see attach, wait, and logs"`
+	Stream    bool          `arg:"--stream" help:"follow output via server-sent events instead of polling"`
+	Key       string        `arg:"--idempotency-key" help:"submitting again with the same key and args returns the first job instead of starting another, for 24h"`
+	Webhook   string        `arg:"--webhook" help:"https url to post the result to after exit, instead of the default set with webhook-set"`
+	Heartbeat time.Duration `arg:"--heartbeat-timeout" help:"give up after this long without a heartbeat from the job, like 10m, negative to never give up"`
+	Argv      []string      `arg:"positional,required"`
 }
 
 func (execArgs) Description() string {
-	return "\nexec\n"
+	return "\nexec\n\nctrl-c cancels the remote job and waits for it to exit, a second ctrl-c exits immediately\n\napi errors exit 64 on bad request, 66 on not found, 75 on rate limit or no heartbeat, and 77 on unauthorized\n"
 }
 
 func exec() {
@@ -31,12 +52,94 @@ func exec() {
 	auth := os.Getenv("AUTH")
 	url := fmt.Sprintf("https://%s", domain)
 	ctx := context.Background()
-	callback := func(logs string) {
-		fmt.Print(logs)
+	opts := rce.ClientOptions{
+		Url:              url,
+		Auth:             auth,
+		Stream:           args.Stream,
+		HeartbeatTimeout: args.Heartbeat,
 	}
-	exitCode, err := rce.Exec(ctx, url, auth, args.Argv, callback, nil)
+	client := rce.NewClient(opts)
+	files := rce.NewFileClient(opts)
+	execReq := &rce.ExecPostRequest{
+		Argv:           args.Argv,
+		Env:            map[string]string{},
+		Dir:            args.Cwd,
+		CleanEnv:       args.CleanEnv,
+		Artifacts:      args.Artifact,
+		Raw:            args.Raw,
+		Timeout:        int(math.Ceil(args.Timeout.Seconds())),
+		Webhook:        args.Webhook,
+		IdempotencyKey: args.Key,
+	}
+	for _, path := range args.EnvFile {
+		err := rce.ReadEnvFile(execReq.Env, path)
+		if err != nil {
+			lib.Logger.Fatal("error: ", err)
+		}
+	}
+	err := rce.ParseEnv(execReq.Env, args.Env)
 	if err != nil {
 		lib.Logger.Fatal("error: ", err)
 	}
-	os.Exit(exitCode)
+	if !args.NoStdin {
+		info, err := os.Stdin.Stat()
+		if err != nil {
+			lib.Logger.Fatal("error: ", err)
+		}
+		// only a file or pipe, since a terminal, socket, or device, like
+		// the stdin of ssh without a tty, may never reach eof
+		if info.Mode().IsRegular() || info.Mode()&os.ModeNamedPipe != 0 {
+			execReq.Stdin, err = rce.ReadStdin(os.Stdin)
+			if err != nil {
+				lib.Logger.Fatal("error: ", err)
+			}
+		}
+	}
+	if args.Upload != "" {
+		execReq.Workspace, err = files.UploadWorkspace(ctx, args.Upload)
+		if err != nil {
+			cli.Fatal(err)
+		}
+	}
+	uid, err := client.Submit(ctx, execReq)
+	if err != nil {
+		cli.Fatal(err)
+	}
+	if args.Detach {
+		fmt.Println(uid)
+		return
+	}
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		// defer func() {}()
+		<-signals
+		lib.Logger.Println("cancelling:", uid)
+		err := client.Cancel(ctx, uid)
+		if err != nil {
+			lib.Logger.Println("error:", err)
+		}
+		<-signals
+		os.Exit(130)
+	}()
+	var received int64
+	result, err := client.Attach(ctx, uid, 0, &rce.CountWriter{W: os.Stdout, N: &received}, &rce.CountWriter{W: os.Stderr, N: &received})
+	if err != nil {
+		var apiErr *rce.APIError
+		if errors.As(err, &apiErr) && apiErr.StatusCode < 500 {
+			cli.Fatal(err)
+		}
+		if errors.Is(err, rce.ErrNoHeartbeat) {
+			cli.Fatal(err)
+		}
+		lib.Logger.Println("error:", err)
+		lib.Logger.Fatalf("resume with: aws-rce attach %s --offset %d", uid, received)
+	}
+	if args.Download != "" {
+		err := files.DownloadArtifacts(ctx, uid, args.Download)
+		if err != nil {
+			cli.Fatal(err)
+		}
+	}
+	os.Exit(result.Exit)
 }
@@ -0,0 +1,116 @@
+package awsrce
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"time"
+
+	"github.com/alexflint/go-arg"
+	"github.com/nathants/aws-rce/rce"
+	"github.com/nathants/libaws/lib"
+)
+
+func init() {
+	lib.Commands["batch"] = batch
+	lib.Args["batch"] = batchArgs{}
+}
+
+type batchArgs struct {
+	Matrix   []string      `arg:"--matrix,separate" help:"KEY=v1,v2 env var expanded to one job per value, may be repeated for every combination"`
+	File     string        `arg:"--file" help:"json batch request, like {\"jobs\": [{\"argv\": [...], \"env\": {...}}]}, instead of argv and matrix"`
+	Env      []string      `arg:"--env,separate" help:"KEY=VAL set on every job, may be repeated"`
+	EnvFile  []string      `arg:"--env-file,separate" help:"file of KEY=VAL lines, may be repeated"`
+	Cwd      string        `arg:"--cwd" help:"working directory of the remote commands"`
+	CleanEnv bool          `arg:"--clean-env" help:"do not inherit the lambda environment"`
+	Upload   string        `arg:"--upload" help:"directory to upload once as the working directory of every job, honors .rceignore"`
+	Timeout  time.Duration `arg:"--timeout" help:"kill each remote command after this long, like 30s or 5m, at most 14m"`
+	Webhook  string        `arg:"--webhook" help:"https url to post each result to after exit, instead of the default set with webhook-set"`
+	Wait     bool          `arg:"--wait" help:"wait for every job to exit, then exit 1 if any failed"`
+	Argv     []string      `arg:"positional"`
+}
+
+func (batchArgs) Description() string {
+	return "\nsubmit a group of jobs and print the group id\n\nwith --matrix the argv is run once per combination of values, with each value set as an env var\n"
+}
+
+func batch() {
+	var args batchArgs
+	arg.MustParse(&args)
+	domain := os.Getenv("PROJECT_DOMAIN")
+	auth := os.Getenv("AUTH")
+	url := fmt.Sprintf("https://%s", domain)
+	ctx := context.Background()
+	opts := rce.ClientOptions{
+		Url:  url,
+		Auth: auth,
+	}
+	client := rce.NewGroupClient(opts)
+	files := rce.NewFileClient(opts)
+	batchReq := &rce.BatchPostRequest{}
+	if args.File != "" {
+		if len(args.Argv) > 0 || len(args.Matrix) > 0 {
+			lib.Logger.Fatal("error: --file cannot be used with argv or --matrix")
+		}
+		data, err := os.ReadFile(args.File)
+		if err != nil {
+			lib.Logger.Fatal("error: ", err)
+		}
+		err = json.Unmarshal(data, batchReq)
+		if err != nil {
+			lib.Logger.Fatal("error: ", err)
+		}
+	} else {
+		if len(args.Argv) == 0 || len(args.Matrix) == 0 {
+			lib.Logger.Fatal("error: argv and --matrix are required without --file")
+		}
+		matrix, err := rce.ParseMatrix(args.Matrix)
+		if err != nil {
+			lib.Logger.Fatal("error: ", err)
+		}
+		template := &rce.ExecPostRequest{
+			Argv:     args.Argv,
+			Env:      map[string]string{},
+			Dir:      args.Cwd,
+			CleanEnv: args.CleanEnv,
+			Timeout:  int(math.Ceil(args.Timeout.Seconds())),
+			Webhook:  args.Webhook,
+		}
+		for _, path := range args.EnvFile {
+			err := rce.ReadEnvFile(template.Env, path)
+			if err != nil {
+				lib.Logger.Fatal("error: ", err)
+			}
+		}
+		err = rce.ParseEnv(template.Env, args.Env)
+		if err != nil {
+			lib.Logger.Fatal("error: ", err)
+		}
+		if args.Upload != "" {
+			template.Workspace, err = files.UploadWorkspace(ctx, args.Upload)
+			if err != nil {
+				lib.Logger.Fatal("error: ", err)
+			}
+		}
+		batchReq.Template = template
+		batchReq.Matrix = matrix
+	}
+	batchResp, err := client.Batch(ctx, batchReq)
+	if err != nil {
+		lib.Logger.Fatal("error: ", err)
+	}
+	fmt.Println(batchResp.GroupId)
+	if !args.Wait {
+		return
+	}
+	status, err := client.WaitGroup(ctx, batchResp.GroupId)
+	if err != nil {
+		lib.Logger.Fatal("error: ", err)
+	}
+	lib.Logger.Printf("passed: %d failed: %d\n", status.Passed, status.Failed)
+	if status.Failed > 0 {
+		os.Exit(1)
+	}
+}
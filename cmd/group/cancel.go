@@ -0,0 +1,40 @@
+package awsrce
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/alexflint/go-arg"
+	"github.com/nathants/aws-rce/rce"
+	"github.com/nathants/libaws/lib"
+)
+
+func init() {
+	lib.Commands["group-cancel"] = groupCancel
+	lib.Args["group-cancel"] = groupCancelArgs{}
+}
+
+type groupCancelArgs struct {
+	Id string `arg:"positional,required"`
+}
+
+func (groupCancelArgs) Description() string {
+	return "\ncancel every job in a group\n"
+}
+
+func groupCancel() {
+	var args groupCancelArgs
+	arg.MustParse(&args)
+	domain := os.Getenv("PROJECT_DOMAIN")
+	auth := os.Getenv("AUTH")
+	url := fmt.Sprintf("https://%s", domain)
+	client := rce.NewGroupClient(rce.ClientOptions{
+		Url:  url,
+		Auth: auth,
+	})
+	err := client.CancelGroup(context.Background(), args.Id)
+	if err != nil {
+		lib.Logger.Fatal("error: ", err)
+	}
+}
@@ -0,0 +1,37 @@
+package awsrce
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/alexflint/go-arg"
+	"github.com/nathants/aws-rce/rce"
+	"github.com/nathants/libaws/lib"
+)
+
+func init() {
+	lib.Commands["group"] = group
+	lib.Args["group"] = groupArgs{}
+}
+
+type groupArgs struct {
+	Id string `arg:"positional,required"`
+}
+
+func (groupArgs) Description() string {
+	return "\nprogress of a group of jobs\n"
+}
+
+func group() {
+	var args groupArgs
+	arg.MustParse(&args)
+	domain := os.Getenv("PROJECT_DOMAIN")
+	auth := os.Getenv("AUTH")
+	url := fmt.Sprintf("https://%s", domain)
+	status, err := rce.Group(context.Background(), url, auth, args.Id)
+	if err != nil {
+		lib.Logger.Fatal("error: ", err)
+	}
+	fmt.Println(lib.Pformat(status))
+}
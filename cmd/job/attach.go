@@ -0,0 +1,72 @@
+package awsrce
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/alexflint/go-arg"
+	"github.com/nathants/aws-rce/cmd/cli"
+	"github.com/nathants/aws-rce/rce"
+	"github.com/nathants/libaws/lib"
+)
+
+func init() {
+	lib.Commands["attach"] = attach
+	lib.Args["attach"] = attachArgs{}
+}
+
+type attachArgs struct {
+	Uid       string        `arg:"positional,required"`
+	Offset    int           `arg:"--offset" help:"skip this many bytes of output, counting stdout and stderr"`
+	Download  string        `arg:"--download" help:"directory to download artifacts into after exit"`
+	Stream    bool          `arg:"--stream" help:"follow output via server-sent events instead of polling"`
+	Heartbeat time.Duration `arg:"--heartbeat-timeout" help:"give up after this long without a heartbeat from the job, like 10m, negative to never give up"`
+}
+
+func (attachArgs) Description() string {
+	return "\nstream the output of a job until it exits, then exit with its exit code\n\nexits 75 if the job has no heartbeat, like exec\n"
+}
+
+func attach() {
+	var args attachArgs
+	arg.MustParse(&args)
+	domain := os.Getenv("PROJECT_DOMAIN")
+	auth := os.Getenv("AUTH")
+	url := fmt.Sprintf("https://%s", domain)
+	ctx := context.Background()
+	opts := rce.ClientOptions{
+		Url:              url,
+		Auth:             auth,
+		Stream:           args.Stream,
+		HeartbeatTimeout: args.Heartbeat,
+	}
+	client := rce.NewClient(opts)
+	files := rce.NewFileClient(opts)
+	received := int64(args.Offset)
+	result, err := client.Attach(ctx, args.Uid, int64(args.Offset), &rce.CountWriter{W: os.Stdout, N: &received}, &rce.CountWriter{W: os.Stderr, N: &received})
+	if errors.Is(err, rce.ErrNoHeartbeat) {
+		cli.Fatal(err)
+	}
+	if err != nil {
+		lib.Logger.Println("error:", err)
+		lib.Logger.Fatalf("resume with: aws-rce attach %s --offset %d", args.Uid, received)
+	}
+	if args.Download != "" {
+		err := files.DownloadArtifacts(ctx, args.Uid, args.Download)
+		if err != nil {
+			lib.Logger.Fatal("error: ", err)
+		}
+	}
+	os.Exit(result.Exit)
+}
+
+func writeStream(stream int, data []byte) {
+	if stream == rce.Stdout {
+		_, _ = os.Stdout.Write(data)
+	} else {
+		_, _ = os.Stderr.Write(data)
+	}
+}
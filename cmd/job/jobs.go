@@ -0,0 +1,82 @@
+package awsrce
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/alexflint/go-arg"
+	"github.com/nathants/aws-rce/rce"
+	"github.com/nathants/libaws/lib"
+)
+
+func init() {
+	lib.Commands["jobs"] = jobs
+	lib.Args["jobs"] = jobsArgs{}
+}
+
+type jobsArgs struct {
+	State    string        `arg:"--state" help:"submitted, running, finished, or failed"`
+	Exit     *int          `arg:"--exit" help:"exit code"`
+	Since    time.Duration `arg:"--since" help:"submitted within this long ago, like 1h"`
+	Until    time.Duration `arg:"--until" help:"submitted at least this long ago, like 10m"`
+	Argv     string        `arg:"--argv" help:"substring of the space joined argv"`
+	Schedule string        `arg:"--schedule" help:"id of the schedule that ran the job"`
+	Limit    int           `arg:"--limit" default:"50" help:"max jobs to list"`
+	Next     string        `arg:"--next" help:"continue from a previous listing"`
+	Json     bool          `arg:"--json" help:"print json instead of a table"`
+}
+
+func (jobsArgs) Description() string {
+	return "\nlist jobs, newest first\n"
+}
+
+func jobs() {
+	var args jobsArgs
+	arg.MustParse(&args)
+	domain := os.Getenv("PROJECT_DOMAIN")
+	auth := os.Getenv("AUTH")
+	url := fmt.Sprintf("https://%s", domain)
+	query := rce.JobsQuery{
+		State:    args.State,
+		Exit:     args.Exit,
+		Argv:     args.Argv,
+		Schedule: args.Schedule,
+		Limit:    args.Limit,
+		Next:     args.Next,
+	}
+	if args.Since != 0 {
+		query.Since = time.Now().Add(-args.Since)
+	}
+	if args.Until != 0 {
+		query.Until = time.Now().Add(-args.Until)
+	}
+	jobsResp, err := rce.Jobs(context.Background(), url, auth, query)
+	if err != nil {
+		lib.Logger.Fatal("error: ", err)
+	}
+	if args.Json {
+		fmt.Println(lib.Pformat(jobsResp))
+		return
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "UID\tSTATE\tEXIT\tSUBMITTED\tDURATION\tARGV")
+	for _, job := range jobsResp.Jobs {
+		exit := "-"
+		if job.Exit != nil {
+			exit = fmt.Sprint(*job.Exit)
+		}
+		duration := time.Duration(job.Duration * float64(time.Second)).Round(time.Second)
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", job.Uid, job.State, exit, job.Submitted.Local().Format(time.RFC3339), duration, strings.Join(job.Argv, " "))
+	}
+	err = w.Flush()
+	if err != nil {
+		lib.Logger.Fatal("error: ", err)
+	}
+	if jobsResp.Next != "" {
+		fmt.Fprintln(os.Stderr, "next:", jobsResp.Next)
+	}
+}
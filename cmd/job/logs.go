@@ -0,0 +1,46 @@
+package awsrce
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/alexflint/go-arg"
+	"github.com/nathants/aws-rce/cmd/cli"
+	"github.com/nathants/aws-rce/rce"
+	"github.com/nathants/libaws/lib"
+)
+
+func init() {
+	lib.Commands["logs"] = logs
+	lib.Args["logs"] = logsArgs{}
+}
+
+type logsArgs struct {
+	Uid    string `arg:"positional,required"`
+	Follow bool   `arg:"-f,--follow" help:"keep streaming until the job exits, then exit with its exit code"`
+}
+
+func (logsArgs) Description() string {
+	return "\nprint the output of a job so far\n\nwith --follow, exits 75 if the job has no heartbeat, like exec\n"
+}
+
+func logs() {
+	var args logsArgs
+	arg.MustParse(&args)
+	domain := os.Getenv("PROJECT_DOMAIN")
+	auth := os.Getenv("AUTH")
+	url := fmt.Sprintf("https://%s", domain)
+	ctx := context.Background()
+	if args.Follow {
+		exitCode, err := rce.Attach(ctx, url, auth, args.Uid, 0, writeStream)
+		if err != nil {
+			cli.Fatal(err)
+		}
+		os.Exit(exitCode)
+	}
+	err := rce.Logs(ctx, url, auth, args.Uid, writeStream)
+	if err != nil {
+		cli.Fatal(err)
+	}
+}
@@ -0,0 +1,37 @@
+package awsrce
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/alexflint/go-arg"
+	"github.com/nathants/aws-rce/rce"
+	"github.com/nathants/libaws/lib"
+)
+
+func init() {
+	lib.Commands["status"] = status
+	lib.Args["status"] = statusArgs{}
+}
+
+type statusArgs struct {
+	Uid string `arg:"positional,required"`
+}
+
+func (statusArgs) Description() string {
+	return "\nstatus of a job\n"
+}
+
+func status() {
+	var args statusArgs
+	arg.MustParse(&args)
+	domain := os.Getenv("PROJECT_DOMAIN")
+	auth := os.Getenv("AUTH")
+	url := fmt.Sprintf("https://%s", domain)
+	status, err := rce.Status(context.Background(), url, auth, args.Uid)
+	if err != nil {
+		lib.Logger.Fatal("error: ", err)
+	}
+	fmt.Println(lib.Pformat(status))
+}
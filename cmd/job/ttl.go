@@ -0,0 +1,62 @@
+package awsrce
+
+import (
+	"context"
+	"os"
+
+	"github.com/alexflint/go-arg"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/nathants/libaws/lib"
+)
+
+func init() {
+	lib.Commands["jobs-ttl-ensure"] = jobsTtlEnsure
+	lib.Args["jobs-ttl-ensure"] = jobsTtlEnsureArgs{}
+}
+
+type jobsTtlEnsureArgs struct {
+}
+
+func (jobsTtlEnsureArgs) Description() string {
+	return "\nenable dynamodb ttl on the ttl attribute, which expires job records\n"
+}
+
+func jobsTtlEnsure() {
+	var args jobsTtlEnsureArgs
+	arg.MustParse(&args)
+	ctx := context.Background()
+	table := os.Getenv("PROJECT_NAME")
+	var out *dynamodb.DescribeTimeToLiveOutput
+	err := lib.Retry(ctx, func() error {
+		var err error
+		out, err = lib.DynamoDBClient().DescribeTimeToLiveWithContext(ctx, &dynamodb.DescribeTimeToLiveInput{
+			TableName: aws.String(table),
+		})
+		return err
+	})
+	if err != nil {
+		lib.Logger.Fatal("error: ", err)
+	}
+	desc := out.TimeToLiveDescription
+	if desc != nil && desc.AttributeName != nil && *desc.AttributeName == "ttl" {
+		switch *desc.TimeToLiveStatus {
+		case dynamodb.TimeToLiveStatusEnabled, dynamodb.TimeToLiveStatusEnabling:
+			return
+		}
+	}
+	err = lib.Retry(ctx, func() error {
+		_, err := lib.DynamoDBClient().UpdateTimeToLiveWithContext(ctx, &dynamodb.UpdateTimeToLiveInput{
+			TableName: aws.String(table),
+			TimeToLiveSpecification: &dynamodb.TimeToLiveSpecification{
+				AttributeName: aws.String("ttl"),
+				Enabled:       aws.Bool(true),
+			},
+		})
+		return err
+	})
+	if err != nil {
+		lib.Logger.Fatal("error: ", err)
+	}
+	lib.Logger.Println("enabled ttl on:", table)
+}
@@ -0,0 +1,38 @@
+package awsrce
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/alexflint/go-arg"
+	"github.com/nathants/aws-rce/cmd/cli"
+	"github.com/nathants/aws-rce/rce"
+	"github.com/nathants/libaws/lib"
+)
+
+func init() {
+	lib.Commands["wait"] = wait
+	lib.Args["wait"] = waitArgs{}
+}
+
+type waitArgs struct {
+	Uid string `arg:"positional,required"`
+}
+
+func (waitArgs) Description() string {
+	return "\nwait for a job to exit, then exit with its exit code\n\nexits 75 if the job has no heartbeat, like exec\n"
+}
+
+func wait() {
+	var args waitArgs
+	arg.MustParse(&args)
+	domain := os.Getenv("PROJECT_DOMAIN")
+	auth := os.Getenv("AUTH")
+	url := fmt.Sprintf("https://%s", domain)
+	exitCode, err := rce.Wait(context.Background(), url, auth, args.Uid)
+	if err != nil {
+		cli.Fatal(err)
+	}
+	os.Exit(exitCode)
+}
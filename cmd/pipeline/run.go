@@ -0,0 +1,81 @@
+package awsrce
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/alexflint/go-arg"
+	"github.com/nathants/aws-rce/rce"
+	"github.com/nathants/libaws/lib"
+)
+
+func init() {
+	lib.Commands["run"] = run
+	lib.Args["run"] = runArgs{}
+}
+
+type runArgs struct {
+	Path string `arg:"positional,required" help:"pipeline yaml file"`
+}
+
+func (runArgs) Description() string {
+	return "\nrun the steps of a pipeline yaml file as jobs, independent steps concurrently\n\nsteps run once the steps they need have passed, and are skipped if any failed. exits 1 if any step did not pass.\n\nctrl-c cancels running steps and waits for them to exit, a second ctrl-c exits immediately\n"
+}
+
+func run() {
+	var args runArgs
+	arg.MustParse(&args)
+	domain := os.Getenv("PROJECT_DOMAIN")
+	auth := os.Getenv("AUTH")
+	url := fmt.Sprintf("https://%s", domain)
+	pipeline, err := rce.LoadPipeline(args.Path)
+	if err != nil {
+		lib.Logger.Fatal("error: ", err)
+	}
+	opts := rce.ClientOptions{
+		Url:  url,
+		Auth: auth,
+	}
+	client := rce.NewClient(opts)
+	files := rce.NewFileClient(opts)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		// defer func() {}()
+		<-signals
+		lib.Logger.Println("cancelling pipeline")
+		cancel()
+		<-signals
+		os.Exit(130)
+	}()
+	results, err := rce.RunPipeline(ctx, client, files, pipeline, os.Stdout, os.Stderr)
+	if err != nil {
+		lib.Logger.Fatal("error: ", err)
+	}
+	width := 0
+	for _, result := range results {
+		width = lib.Max(width, len(result.Name))
+	}
+	code := 0
+	fmt.Fprintln(os.Stderr)
+	for _, result := range results {
+		line := fmt.Sprintf("%-*s %-7s", width, result.Name, result.State)
+		if result.Uid != "" {
+			line += fmt.Sprintf(" exit=%d duration=%s uid=%s", result.Exit, result.Duration.Round(time.Second), result.Uid)
+		}
+		if result.Err != nil {
+			line += fmt.Sprintf(" error=%s", result.Err)
+		}
+		fmt.Fprintln(os.Stderr, line)
+		if result.State != rce.StepPassed {
+			code = 1
+		}
+	}
+	os.Exit(code)
+}
@@ -0,0 +1,68 @@
+package awsrce
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"time"
+
+	"github.com/alexflint/go-arg"
+	"github.com/nathants/aws-rce/rce"
+	"github.com/nathants/libaws/lib"
+)
+
+func init() {
+	lib.Commands["schedule-add"] = scheduleAdd
+	lib.Args["schedule-add"] = scheduleAddArgs{}
+}
+
+type scheduleAddArgs struct {
+	Name     string        `arg:"positional,required"`
+	Cron     string        `arg:"positional,required" help:"minute hour day-of-month month day-of-week in utc, like '0 9 * * 1-5' or @daily"`
+	Env      []string      `arg:"--env,separate" help:"KEY=VAL, may be repeated"`
+	EnvFile  []string      `arg:"--env-file,separate" help:"file of KEY=VAL lines, may be repeated"`
+	Cwd      string        `arg:"--cwd" help:"working directory of the remote command"`
+	CleanEnv bool          `arg:"--clean-env" help:"do not inherit the lambda environment"`
+	Timeout  time.Duration `arg:"--timeout" help:"kill the remote command after this long, like 30s or 5m, at most 14m"`
+	Webhook  string        `arg:"--webhook" help:"https url to post each result to after exit, instead of the default set with webhook-set"`
+	Argv     []string      `arg:"positional,required"`
+}
+
+func (scheduleAddArgs) Description() string {
+	return "\nadd a schedule that runs a job on a cron expression and print its id\n\nschedules are checked every 5 minutes, so a job starts up to 5 minutes after its cron time\n"
+}
+
+func scheduleAdd() {
+	var args scheduleAddArgs
+	arg.MustParse(&args)
+	domain := os.Getenv("PROJECT_DOMAIN")
+	auth := os.Getenv("AUTH")
+	url := fmt.Sprintf("https://%s", domain)
+	scheduleReq := &rce.SchedulePostRequest{
+		Name:     args.Name,
+		Cron:     args.Cron,
+		Argv:     args.Argv,
+		Env:      map[string]string{},
+		Dir:      args.Cwd,
+		CleanEnv: args.CleanEnv,
+		Timeout:  int(math.Ceil(args.Timeout.Seconds())),
+		Webhook:  args.Webhook,
+	}
+	for _, path := range args.EnvFile {
+		err := rce.ReadEnvFile(scheduleReq.Env, path)
+		if err != nil {
+			lib.Logger.Fatal("error: ", err)
+		}
+	}
+	err := rce.ParseEnv(scheduleReq.Env, args.Env)
+	if err != nil {
+		lib.Logger.Fatal("error: ", err)
+	}
+	schedule, err := rce.AddSchedule(context.Background(), url, auth, scheduleReq)
+	if err != nil {
+		lib.Logger.Fatal("error: ", err)
+	}
+	fmt.Println(schedule.Id)
+	lib.Logger.Println("next run:", schedule.Next.Local().Format(time.RFC3339))
+}
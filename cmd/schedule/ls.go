@@ -0,0 +1,56 @@
+package awsrce
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/alexflint/go-arg"
+	"github.com/nathants/aws-rce/rce"
+	"github.com/nathants/libaws/lib"
+)
+
+func init() {
+	lib.Commands["schedule-ls"] = scheduleLs
+	lib.Args["schedule-ls"] = scheduleLsArgs{}
+}
+
+type scheduleLsArgs struct {
+	Json bool `arg:"--json" help:"print json instead of a table"`
+}
+
+func (scheduleLsArgs) Description() string {
+	return "\nls schedules\n"
+}
+
+func scheduleLs() {
+	var args scheduleLsArgs
+	arg.MustParse(&args)
+	domain := os.Getenv("PROJECT_DOMAIN")
+	auth := os.Getenv("AUTH")
+	url := fmt.Sprintf("https://%s", domain)
+	schedules, err := rce.Schedules(context.Background(), url, auth)
+	if err != nil {
+		lib.Logger.Fatal("error: ", err)
+	}
+	if args.Json {
+		fmt.Println(lib.Pformat(schedules))
+		return
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "ID\tNAME\tCRON\tNEXT\tLAST RUN\tARGV")
+	for _, schedule := range schedules {
+		lastRun := "-"
+		if schedule.LastRun != "" {
+			lastRun = schedule.LastRun
+		}
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", schedule.Id, schedule.Name, schedule.Cron, schedule.Next.Local().Format(time.RFC3339), lastRun, strings.Join(schedule.Argv, " "))
+	}
+	err = w.Flush()
+	if err != nil {
+		lib.Logger.Fatal("error: ", err)
+	}
+}
@@ -0,0 +1,40 @@
+package awsrce
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/alexflint/go-arg"
+	"github.com/nathants/aws-rce/rce"
+	"github.com/nathants/libaws/lib"
+)
+
+func init() {
+	lib.Commands["schedule-rm"] = scheduleRm
+	lib.Args["schedule-rm"] = scheduleRmArgs{}
+}
+
+type scheduleRmArgs struct {
+	Id string `arg:"positional,required"`
+}
+
+func (scheduleRmArgs) Description() string {
+	return "\nrm schedule, its past runs are kept\n"
+}
+
+func scheduleRm() {
+	var args scheduleRmArgs
+	arg.MustParse(&args)
+	domain := os.Getenv("PROJECT_DOMAIN")
+	auth := os.Getenv("AUTH")
+	url := fmt.Sprintf("https://%s", domain)
+	client := rce.NewScheduleClient(rce.ClientOptions{
+		Url:  url,
+		Auth: auth,
+	})
+	err := client.RemoveSchedule(context.Background(), args.Id)
+	if err != nil {
+		lib.Logger.Fatal("error: ", err)
+	}
+}
@@ -0,0 +1,61 @@
+package awsrce
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/alexflint/go-arg"
+	"github.com/nathants/aws-rce/rce"
+	"github.com/nathants/libaws/lib"
+)
+
+func init() {
+	lib.Commands["schedule-runs"] = scheduleRuns
+	lib.Args["schedule-runs"] = scheduleRunsArgs{}
+}
+
+type scheduleRunsArgs struct {
+	Id   string `arg:"positional,required"`
+	Json bool   `arg:"--json" help:"print json instead of a table"`
+}
+
+func (scheduleRunsArgs) Description() string {
+	return "\nrecent runs of a schedule, newest first, see also jobs --schedule\n"
+}
+
+func scheduleRuns() {
+	var args scheduleRunsArgs
+	arg.MustParse(&args)
+	domain := os.Getenv("PROJECT_DOMAIN")
+	auth := os.Getenv("AUTH")
+	url := fmt.Sprintf("https://%s", domain)
+	client := rce.NewScheduleClient(rce.ClientOptions{
+		Url:  url,
+		Auth: auth,
+	})
+	scheduleResp, err := client.Schedule(context.Background(), args.Id)
+	if err != nil {
+		lib.Logger.Fatal("error: ", err)
+	}
+	if args.Json {
+		fmt.Println(lib.Pformat(scheduleResp))
+		return
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "UID\tSTATE\tEXIT\tSUBMITTED\tDURATION")
+	for _, job := range scheduleResp.Runs {
+		exit := "-"
+		if job.Exit != nil {
+			exit = fmt.Sprint(*job.Exit)
+		}
+		duration := time.Duration(job.Duration * float64(time.Second)).Round(time.Second)
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", job.Uid, job.State, exit, job.Submitted.Local().Format(time.RFC3339), duration)
+	}
+	err = w.Flush()
+	if err != nil {
+		lib.Logger.Fatal("error: ", err)
+	}
+}
@@ -0,0 +1,45 @@
+package awsrce
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/alexflint/go-arg"
+	"github.com/nathants/aws-rce/rce"
+	"github.com/nathants/libaws/lib"
+)
+
+func init() {
+	lib.Commands["webhook-get"] = webhookGet
+	lib.Args["webhook-get"] = webhookGetArgs{}
+}
+
+type webhookGetArgs struct {
+	Secret bool `arg:"--secret" help:"print the secret that signs webhook posts instead, see rce.VerifyWebhook"`
+}
+
+func (webhookGetArgs) Description() string {
+	return "\nget the default webhook of this auth\n"
+}
+
+func webhookGet() {
+	var args webhookGetArgs
+	arg.MustParse(&args)
+	domain := os.Getenv("PROJECT_DOMAIN")
+	auth := os.Getenv("AUTH")
+	url := fmt.Sprintf("https://%s", domain)
+	client := rce.NewWebhookClient(rce.ClientOptions{
+		Url:  url,
+		Auth: auth,
+	})
+	webhook, err := client.Webhook(context.Background())
+	if err != nil {
+		lib.Logger.Fatal("error: ", err)
+	}
+	if args.Secret {
+		fmt.Println(webhook.Secret)
+	} else if webhook.Url != "" {
+		fmt.Println(webhook.Url)
+	}
+}
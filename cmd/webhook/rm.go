@@ -0,0 +1,39 @@
+package awsrce
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/alexflint/go-arg"
+	"github.com/nathants/aws-rce/rce"
+	"github.com/nathants/libaws/lib"
+)
+
+func init() {
+	lib.Commands["webhook-rm"] = webhookRm
+	lib.Args["webhook-rm"] = webhookRmArgs{}
+}
+
+type webhookRmArgs struct {
+}
+
+func (webhookRmArgs) Description() string {
+	return "\nrm the default webhook of this auth\n"
+}
+
+func webhookRm() {
+	var args webhookRmArgs
+	arg.MustParse(&args)
+	domain := os.Getenv("PROJECT_DOMAIN")
+	auth := os.Getenv("AUTH")
+	url := fmt.Sprintf("https://%s", domain)
+	client := rce.NewWebhookClient(rce.ClientOptions{
+		Url:  url,
+		Auth: auth,
+	})
+	err := client.RemoveWebhook(context.Background())
+	if err != nil {
+		lib.Logger.Fatal("error: ", err)
+	}
+}
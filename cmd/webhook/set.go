@@ -0,0 +1,41 @@
+package awsrce
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/alexflint/go-arg"
+	"github.com/nathants/aws-rce/rce"
+	"github.com/nathants/libaws/lib"
+)
+
+func init() {
+	lib.Commands["webhook-set"] = webhookSet
+	lib.Args["webhook-set"] = webhookSetArgs{}
+}
+
+type webhookSetArgs struct {
+	Url string `arg:"positional,required" help:"https url"`
+}
+
+func (webhookSetArgs) Description() string {
+	return "\nset the default webhook of this auth, posted to after each job exits unless the job sets its own\n\nprints the secret that signs webhook posts, see rce.VerifyWebhook\n"
+}
+
+func webhookSet() {
+	var args webhookSetArgs
+	arg.MustParse(&args)
+	domain := os.Getenv("PROJECT_DOMAIN")
+	auth := os.Getenv("AUTH")
+	url := fmt.Sprintf("https://%s", domain)
+	client := rce.NewWebhookClient(rce.ClientOptions{
+		Url:  url,
+		Auth: auth,
+	})
+	webhook, err := client.SetWebhook(context.Background(), args.Url)
+	if err != nil {
+		lib.Logger.Fatal("error: ", err)
+	}
+	fmt.Println(webhook.Secret)
+}
@@ -10,6 +10,8 @@ require (
 	github.com/gofrs/uuid v4.2.0+incompatible
 	github.com/nathants/libaws v0.0.0-20220528092433-347400c541e1
 	golang.org/x/crypto v0.0.0-20220525230936-793ad666bf5e
+	golang.org/x/sys v0.0.0-20211216021012-1d35b9e2eb4e
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -24,7 +26,5 @@ require (
 	github.com/vmihailenco/msgpack v4.0.4+incompatible // indirect
 	golang.org/x/net v0.0.0-20220127200216-cd36cc0744dd // indirect
 	golang.org/x/sync v0.0.0-20220513210516-0976fa681c29 // indirect
-	golang.org/x/sys v0.0.0-20211216021012-1d35b9e2eb4e // indirect
 	google.golang.org/appengine v1.6.6 // indirect
-	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
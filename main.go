@@ -10,6 +10,11 @@ import (
 
 	_ "github.com/nathants/aws-rce/cmd/auth"
 	_ "github.com/nathants/aws-rce/cmd/exec"
+	_ "github.com/nathants/aws-rce/cmd/group"
+	_ "github.com/nathants/aws-rce/cmd/job"
+	_ "github.com/nathants/aws-rce/cmd/pipeline"
+	_ "github.com/nathants/aws-rce/cmd/schedule"
+	_ "github.com/nathants/aws-rce/cmd/webhook"
 
 	"github.com/nathants/libaws/lib"
 )
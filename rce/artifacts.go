@@ -0,0 +1,26 @@
+package rce
+
+import (
+	"context"
+)
+
+type Artifact struct {
+	Path string `json:"path"`
+	Size int64  `json:"size"`
+	Url  string `json:"url"`
+}
+
+type ArtifactsGetResponse struct {
+	Artifacts []Artifact `json:"artifacts"`
+}
+
+// list the artifacts of a finished job with presigned download urls.
+func Artifacts(ctx context.Context, url, auth, uid string) ([]Artifact, error) {
+	return NewFileClient(ClientOptions{Url: url, Auth: auth}).Artifacts(ctx, uid)
+}
+
+// download the artifacts of a finished job into dest, preserving their
+// paths relative to the job's working directory.
+func DownloadArtifacts(ctx context.Context, url, auth, uid, dest string) error {
+	return NewFileClient(ClientOptions{Url: url, Auth: auth}).DownloadArtifacts(ctx, uid, dest)
+}
@@ -0,0 +1,821 @@
+package rce
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/nathants/libaws/lib"
+)
+
+// satisfied by lib.Logger and *log.Logger
+type Logger interface {
+	Println(v ...interface{})
+}
+
+// zero values get defaults: http.Client{}, 7 retry attempts,
+// LogShipInterval, lib.Logger, and HeartbeatTimeout.
+type ClientOptions struct {
+	Url              string
+	Auth             string
+	HttpClient       *http.Client
+	RetryAttempts    int           // attempts per request, see lib.RetryAttempts for total delay
+	PollInterval     time.Duration // time between status polls in Wait, log gets long poll instead
+	Logger           Logger
+	Stream           bool          // follow logs via server-sent events from /api/exec/stream instead of polling
+	HeartbeatTimeout time.Duration // give up following a job with ErrNoHeartbeat after this long without a heartbeat, negative to never give up
+}
+
+type ExecResult struct {
+	Uid         string        `json:"uid"`
+	Exit        int           `json:"exit"`
+	Signal      string        `json:"signal,omitempty"`
+	Reason      string        `json:"reason,omitempty"`
+	Duration    time.Duration `json:"duration"` // runtime of the job, from started until ended
+	StdoutBytes int64         `json:"stdout-bytes"`
+	StderrBytes int64         `json:"stderr-bytes"`
+}
+
+// adds the number of bytes written to w to n. the writers for stdout
+// and stderr can share n, so a lost connection can be resumed from the
+// total with Attach.
+type CountWriter struct {
+	W io.Writer
+	N *int64
+}
+
+func (w *CountWriter) Write(data []byte) (int, error) {
+	n, err := w.W.Write(data)
+	*w.N += int64(n)
+	return n, err
+}
+
+// submit, follow, cancel, and check the status of jobs. the other
+// endpoints are on FileClient, JobsClient, GroupClient, ScheduleClient,
+// and WebhookClient, so a fake only needs the methods a caller uses.
+// errors from the api are *APIError, see ErrUnauthorized and friends.
+type Client interface {
+	// submit a job and stream its output until it exits. if stderr is
+	// nil, stderr is written to stdout. see the package level Exec for
+	// push urls.
+	Exec(ctx context.Context, execReq *ExecPostRequest, stdout, stderr io.Writer) (*ExecResult, error)
+	Submit(ctx context.Context, execReq *ExecPostRequest) (string, error)
+	// stream output until exit, skipping offset bytes of output
+	Attach(ctx context.Context, uid string, offset int64, stdout, stderr io.Writer) (*ExecResult, error)
+	Wait(ctx context.Context, uid string) (int, error)
+	Logs(ctx context.Context, uid string, stdout, stderr io.Writer) error
+	Cancel(ctx context.Context, uid string) error
+	Status(ctx context.Context, uid string) (*JobStatus, error)
+}
+
+// uploads for stdin and workspaces, and artifacts of finished jobs
+type FileClient interface {
+	Upload(ctx context.Context, r io.ReadSeeker, size int64) (string, error)
+	UploadWorkspace(ctx context.Context, dir string) (string, error)
+	Artifacts(ctx context.Context, uid string) ([]Artifact, error)
+	DownloadArtifacts(ctx context.Context, uid, dest string) error
+}
+
+type JobsClient interface {
+	Jobs(ctx context.Context, query JobsQuery) (*JobsGetResponse, error)
+}
+
+type GroupClient interface {
+	// submit a group of jobs, see BatchPostRequest
+	Batch(ctx context.Context, batchReq *BatchPostRequest) (*BatchPostResponse, error)
+	Group(ctx context.Context, id string) (*GroupStatus, error)
+	// poll the group until every job has exited
+	WaitGroup(ctx context.Context, id string) (*GroupStatus, error)
+	CancelGroup(ctx context.Context, id string) error
+}
+
+type ScheduleClient interface {
+	AddSchedule(ctx context.Context, scheduleReq *SchedulePostRequest) (*Schedule, error)
+	Schedules(ctx context.Context) ([]Schedule, error)
+	// a schedule and its recent runs
+	Schedule(ctx context.Context, id string) (*ScheduleGetResponse, error)
+	RemoveSchedule(ctx context.Context, id string) error
+}
+
+type WebhookClient interface {
+	// the default webhook of this auth, empty if unset, and the secret
+	// that signs the webhook posts of its jobs
+	Webhook(ctx context.Context) (*WebhookGetResponse, error)
+	SetWebhook(ctx context.Context, url string) (*WebhookGetResponse, error)
+	RemoveWebhook(ctx context.Context) error
+}
+
+type client struct {
+	opts ClientOptions
+}
+
+func NewClient(opts ClientOptions) Client {
+	return newClient(opts)
+}
+
+func NewFileClient(opts ClientOptions) FileClient {
+	return newClient(opts)
+}
+
+func NewJobsClient(opts ClientOptions) JobsClient {
+	return newClient(opts)
+}
+
+func NewGroupClient(opts ClientOptions) GroupClient {
+	return newClient(opts)
+}
+
+func NewScheduleClient(opts ClientOptions) ScheduleClient {
+	return newClient(opts)
+}
+
+func NewWebhookClient(opts ClientOptions) WebhookClient {
+	return newClient(opts)
+}
+
+func newClient(opts ClientOptions) *client {
+	if opts.HttpClient == nil {
+		opts.HttpClient = &http.Client{}
+	}
+	if opts.RetryAttempts == 0 {
+		opts.RetryAttempts = 7
+	}
+	if opts.PollInterval == 0 {
+		opts.PollInterval = LogShipInterval
+	}
+	if opts.Logger == nil {
+		opts.Logger = lib.Logger
+	}
+	if opts.HeartbeatTimeout == 0 {
+		opts.HeartbeatTimeout = HeartbeatTimeout
+	}
+	return &client{opts: opts}
+}
+
+// send an authenticated api request and decode a json response into
+// val, if val is not nil. network errors, 5xx, and 409 are retried,
+// other non 200 responses are returned immediately as *APIError.
+func (c *client) do(ctx context.Context, method, path string, body []byte, val interface{}) error {
+	return c.doHeaders(ctx, method, path, nil, body, val)
+}
+
+func (c *client) doHeaders(ctx context.Context, method, path string, headers map[string]string, body []byte, val interface{}) error {
+	var apiErr error
+	err := lib.RetryAttempts(ctx, c.opts.RetryAttempts, func() error {
+		var reqBody io.Reader
+		if body != nil {
+			reqBody = bytes.NewReader(body)
+		}
+		req, err := http.NewRequestWithContext(ctx, method, c.opts.Url+path, reqBody)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("auth", c.opts.Auth)
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		out, err := c.opts.HttpClient.Do(req)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = out.Body.Close() }()
+		data, err := io.ReadAll(out.Body)
+		if err != nil {
+			return err
+		}
+		if out.StatusCode >= 500 || out.StatusCode == http.StatusConflict {
+			return newAPIError(out, data)
+		}
+		if out.StatusCode != 200 {
+			apiErr = newAPIError(out, data)
+			return nil
+		}
+		if val == nil {
+			return nil
+		}
+		return json.Unmarshal(data, val)
+	})
+	if err == nil {
+		err = apiErr
+	}
+	if err != nil {
+		c.opts.Logger.Println("error:", err)
+		return err
+	}
+	return nil
+}
+
+func (c *client) Exec(ctx context.Context, execReq *ExecPostRequest, stdout, stderr io.Writer) (*ExecResult, error) {
+	uid, err := c.Submit(ctx, execReq)
+	if err != nil {
+		return nil, err
+	}
+	if execReq.PushUrls != nil {
+		return &ExecResult{Uid: uid, Exit: -1}, nil
+	}
+	return c.Attach(ctx, uid, 0, stdout, stderr)
+}
+
+func (c *client) Submit(ctx context.Context, execReq *ExecPostRequest) (string, error) {
+	postRequest := *execReq
+	if len(postRequest.Stdin) > MaxInlineStdin {
+		id, err := c.Upload(ctx, bytes.NewReader(postRequest.Stdin), int64(len(postRequest.Stdin)))
+		if err != nil {
+			return "", err
+		}
+		postRequest.Stdin = nil
+		postRequest.StdinUpload = id
+	}
+	err := postRequest.Validate()
+	if err != nil {
+		return "", err
+	}
+	data, err := json.Marshal(postRequest)
+	if err != nil {
+		return "", err
+	}
+	// retries of the post reuse the key, so a lost response cannot start a second job
+	idempotencyKey := postRequest.IdempotencyKey
+	if idempotencyKey == "" {
+		idempotencyKey = RandKey()
+	}
+	postResponse := ExecPostResponse{}
+	err = c.doHeaders(ctx, http.MethodPost, "/api/exec", map[string]string{IdempotencyKeyHeader: idempotencyKey}, data, &postResponse)
+	if err != nil {
+		return "", err
+	}
+	return postResponse.Uid, nil
+}
+
+func (c *client) Attach(ctx context.Context, uid string, offset int64, stdout, stderr io.Writer) (*ExecResult, error) {
+	if stderr == nil {
+		stderr = stdout
+	}
+	result := &ExecResult{Uid: uid}
+	readLog := c.readLog
+	if c.opts.Stream {
+		readLog = c.streamLog
+	}
+	getResp, err := readLog(ctx, uid, offset, true, func(stream int, data []byte) error {
+		if stream == Stdout {
+			result.StdoutBytes += int64(len(data))
+			_, err := stdout.Write(data)
+			return err
+		}
+		result.StderrBytes += int64(len(data))
+		_, err := stderr.Write(data)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	result.Exit = *getResp.Exit
+	result.Signal = getResp.Signal
+	result.Reason = getResp.Reason
+	status, err := c.Status(ctx, uid)
+	if err != nil {
+		return nil, err
+	}
+	result.Duration = time.Duration(status.Duration * float64(time.Second))
+	return result, nil
+}
+
+func (c *client) Logs(ctx context.Context, uid string, stdout, stderr io.Writer) error {
+	if stderr == nil {
+		stderr = stdout
+	}
+	_, err := c.readLog(ctx, uid, 0, false, func(stream int, data []byte) error {
+		if stream == Stdout {
+			_, err := stdout.Write(data)
+			return err
+		}
+		_, err := stderr.Write(data)
+		return err
+	})
+	return err
+}
+
+func (c *client) Wait(ctx context.Context, uid string) (int, error) {
+	for {
+		status, err := c.Status(ctx, uid)
+		if err != nil {
+			return -1, err
+		}
+		if status.Exit != nil {
+			return *status.Exit, nil
+		}
+		err = c.checkHeartbeat(status)
+		if err != nil {
+			return -1, err
+		}
+		select {
+		case <-ctx.Done():
+			return -1, ctx.Err()
+		case <-time.After(c.opts.PollInterval):
+		}
+	}
+}
+
+// the async lambda updates the heartbeat every HeartbeatInterval while
+// the job runs. the scheduled event marks a job lost once it goes
+// stale, so this only fails if that did not happen either.
+func (c *client) checkHeartbeat(status *JobStatus) error {
+	if c.opts.HeartbeatTimeout < 0 || status.Exit != nil || status.Heartbeat == nil {
+		return nil
+	}
+	since := time.Since(*status.Heartbeat)
+	if since > c.opts.HeartbeatTimeout {
+		err := fmt.Errorf("%w from %s for %s", ErrNoHeartbeat, status.Uid, since.Round(time.Second))
+		c.opts.Logger.Println("error:", err)
+		return err
+	}
+	return nil
+}
+
+// check the heartbeat at most every HeartbeatInterval while a followed
+// log is idle
+func (c *client) checkIdleHeartbeat(ctx context.Context, uid string, lastCheck *time.Time) error {
+	if c.opts.HeartbeatTimeout < 0 || time.Since(*lastCheck) < HeartbeatInterval {
+		return nil
+	}
+	*lastCheck = time.Now()
+	status, err := c.Status(ctx, uid)
+	if err != nil {
+		return err
+	}
+	return c.checkHeartbeat(status)
+}
+
+// read the log from the start, skipping offset bytes of output. when
+// follow is true it returns once the job exits, else it returns once
+// no more log is available, with a nil exit if the job has not exited.
+func (c *client) readLog(ctx context.Context, uid string, offset int64, follow bool, logDataCallback func(stream int, data []byte) error) (*ExecGetResponse, error) {
+	// fail fast on an unknown uid, which would otherwise poll forever
+	_, err := c.Status(ctx, uid)
+	if err != nil {
+		return nil, err
+	}
+	// the api holds each get for up to wait seconds until there is new
+	// log, so there is no sleep between gets while following
+	wait := 0
+	if follow {
+		wait = MaxLongPollWait
+	}
+	rangeStart := 0
+	lastHeartbeatCheck := time.Now()
+	var pending []byte
+	consume := func(data []byte) error {
+		rangeStart += len(data)
+		pending = append(pending, data...)
+		frames, n, err := DecodeFrames(pending)
+		if err != nil {
+			c.opts.Logger.Println("error:", err)
+			return err
+		}
+		for _, frame := range frames {
+			size := int64(len(frame.Data))
+			if offset >= size {
+				offset -= size
+				continue
+			}
+			err := logDataCallback(frame.Stream, frame.Data[offset:])
+			if err != nil {
+				return err
+			}
+			offset = 0
+		}
+		pending = pending[n:]
+		return nil
+	}
+	for {
+		getResp := &ExecGetResponse{}
+		err := c.do(ctx, http.MethodGet, fmt.Sprintf("/api/exec?uid=%s&range-start=%d&wait=%d", uid, rangeStart, wait), nil, getResp)
+		if err != nil {
+			return nil, err
+		}
+		if getResp.Exit != nil {
+			return getResp, nil
+		}
+		if len(getResp.Chunks) == 0 && len(getResp.Data) == 0 {
+			if !follow {
+				return getResp, nil
+			}
+			err := c.checkIdleHeartbeat(ctx, uid, &lastHeartbeatCheck)
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if len(getResp.Data) != 0 {
+			err := consume(getResp.Data)
+			if err != nil {
+				return nil, err
+			}
+		}
+		for _, chunk := range getResp.Chunks {
+			data, err := c.getLogChunk(ctx, chunk)
+			if err != nil {
+				c.opts.Logger.Println("error:", err)
+				return nil, err
+			}
+			err = consume(data)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+// follow the log via server-sent events until the exit event,
+// reconnecting from the last event id. log events are passed to the
+// callback once their batch is complete, so a retry after a partial
+// response does not duplicate output.
+func (c *client) streamLog(ctx context.Context, uid string, offset int64, follow bool, logDataCallback func(stream int, data []byte) error) (*ExecGetResponse, error) {
+	if !follow {
+		return c.readLog(ctx, uid, offset, follow, logDataCallback)
+	}
+	lastEventId := "0"
+	lastHeartbeatCheck := time.Now()
+	var exit *ExitStatus
+	for exit == nil {
+		// each response covers up to MaxLongPollWait, so check between reconnects
+		err := c.checkIdleHeartbeat(ctx, uid, &lastHeartbeatCheck)
+		if err != nil {
+			return nil, err
+		}
+		var apiErr error
+		err = lib.RetryAttempts(ctx, c.opts.RetryAttempts, func() error {
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.opts.Url+fmt.Sprintf("/api/exec/stream?uid=%s", uid), nil)
+			if err != nil {
+				return err
+			}
+			req.Header.Set("auth", c.opts.Auth)
+			req.Header.Set("Accept", "text/event-stream")
+			req.Header.Set("Last-Event-ID", lastEventId)
+			out, err := c.opts.HttpClient.Do(req)
+			if err != nil {
+				return err
+			}
+			defer func() { _ = out.Body.Close() }()
+			if out.StatusCode != 200 {
+				data, err := io.ReadAll(out.Body)
+				if err != nil {
+					return err
+				}
+				if out.StatusCode >= 500 {
+					return newAPIError(out, data)
+				}
+				apiErr = newAPIError(out, data)
+				return nil
+			}
+			var batch []StreamLog
+			return DecodeStreamEvents(out.Body, func(event StreamEvent) error {
+				switch event.Event {
+				case StreamEventLog:
+					streamLog := StreamLog{}
+					err := json.Unmarshal(event.Data, &streamLog)
+					if err != nil {
+						return err
+					}
+					batch = append(batch, streamLog)
+				case StreamEventExit:
+					exit = &ExitStatus{}
+					err := json.Unmarshal(event.Data, exit)
+					if err != nil {
+						return err
+					}
+				default:
+				}
+				if event.Id == "" {
+					return nil
+				}
+				for _, streamLog := range batch {
+					size := int64(len(streamLog.Data))
+					if offset >= size {
+						offset -= size
+						continue
+					}
+					err := logDataCallback(streamLog.Stream, streamLog.Data[offset:])
+					if err != nil {
+						return err
+					}
+					offset = 0
+				}
+				batch = nil
+				lastEventId = event.Id
+				return nil
+			})
+		})
+		if err == nil {
+			err = apiErr
+		}
+		if err != nil {
+			c.opts.Logger.Println("error:", err)
+			return nil, err
+		}
+	}
+	code := exit.Exit
+	return &ExecGetResponse{
+		Exit:   &code,
+		Signal: exit.Signal,
+		Reason: exit.Reason,
+	}, nil
+}
+
+func (c *client) getLogChunk(ctx context.Context, chunk LogChunk) ([]byte, error) {
+	var data []byte
+	err := lib.RetryAttempts(ctx, c.opts.RetryAttempts, func() error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, chunk.Url, nil)
+		if err != nil {
+			return err
+		}
+		if chunk.Range != "" {
+			req.Header.Set("range", chunk.Range)
+		}
+		out, err := c.opts.HttpClient.Do(req)
+		if err != nil {
+			return err
+		}
+		data, err = io.ReadAll(out.Body)
+		if err != nil {
+			return err
+		}
+		err = out.Body.Close()
+		if err != nil {
+			return err
+		}
+		switch out.StatusCode {
+		case 200, 206:
+			return nil
+		default:
+			data = nil
+			err := fmt.Errorf("http %d", out.StatusCode)
+			c.opts.Logger.Println("error:", err)
+			return err
+		}
+	})
+	return data, err
+}
+
+func (c *client) Cancel(ctx context.Context, uid string) error {
+	return c.do(ctx, http.MethodDelete, fmt.Sprintf("/api/exec?uid=%s", uid), nil, nil)
+}
+
+func (c *client) Status(ctx context.Context, uid string) (*JobStatus, error) {
+	status := &JobStatus{}
+	err := c.do(ctx, http.MethodGet, fmt.Sprintf("/api/exec/status?uid=%s", uid), nil, status)
+	if err != nil {
+		return nil, err
+	}
+	return status, nil
+}
+
+func (c *client) Jobs(ctx context.Context, query JobsQuery) (*JobsGetResponse, error) {
+	jobsResp := &JobsGetResponse{}
+	err := c.do(ctx, http.MethodGet, "/api/jobs?"+query.Values().Encode(), nil, jobsResp)
+	if err != nil {
+		return nil, err
+	}
+	return jobsResp, nil
+}
+
+func (c *client) Upload(ctx context.Context, r io.ReadSeeker, size int64) (string, error) {
+	uploadResp := UploadPostResponse{}
+	err := c.do(ctx, http.MethodPost, "/api/upload", nil, &uploadResp)
+	if err != nil {
+		return "", err
+	}
+	err = lib.RetryAttempts(ctx, c.opts.RetryAttempts, func() error {
+		_, err := r.Seek(0, io.SeekStart)
+		if err != nil {
+			return err
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodPut, uploadResp.Url, io.NopCloser(r))
+		if err != nil {
+			return err
+		}
+		req.ContentLength = size
+		out, err := c.opts.HttpClient.Do(req)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = out.Body.Close() }()
+		data, err := io.ReadAll(out.Body)
+		if err != nil {
+			return err
+		}
+		if out.StatusCode != 200 {
+			return fmt.Errorf("%d %s", out.StatusCode, string(data))
+		}
+		return nil
+	})
+	if err != nil {
+		c.opts.Logger.Println("error:", err)
+		return "", err
+	}
+	return uploadResp.Id, nil
+}
+
+func (c *client) UploadWorkspace(ctx context.Context, dir string) (string, error) {
+	f, err := os.CreateTemp("", "aws-rce.*.tar.gz")
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		_ = f.Close()
+		_ = os.Remove(f.Name())
+	}()
+	err = TarWorkspace(dir, f)
+	if err != nil {
+		return "", err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+	return c.Upload(ctx, f, info.Size())
+}
+
+func (c *client) Artifacts(ctx context.Context, uid string) ([]Artifact, error) {
+	getResp := ArtifactsGetResponse{}
+	err := c.do(ctx, http.MethodGet, fmt.Sprintf("/api/exec/artifacts?uid=%s", uid), nil, &getResp)
+	if err != nil {
+		return nil, err
+	}
+	return getResp.Artifacts, nil
+}
+
+func (c *client) DownloadArtifacts(ctx context.Context, uid, dest string) error {
+	artifacts, err := c.Artifacts(ctx, uid)
+	if err != nil {
+		return err
+	}
+	for _, artifact := range artifacts {
+		artifact := artifact
+		name := filepath.Clean(filepath.FromSlash(artifact.Path))
+		if filepath.IsAbs(name) || name == ".." || strings.HasPrefix(name, ".."+string(filepath.Separator)) {
+			return fmt.Errorf("artifact path escapes dest: %s", artifact.Path)
+		}
+		path := filepath.Join(dest, name)
+		err := os.MkdirAll(filepath.Dir(path), 0755)
+		if err != nil {
+			return err
+		}
+		err = lib.RetryAttempts(ctx, c.opts.RetryAttempts, func() error {
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, artifact.Url, nil)
+			if err != nil {
+				return err
+			}
+			out, err := c.opts.HttpClient.Do(req)
+			if err != nil {
+				return err
+			}
+			defer func() { _ = out.Body.Close() }()
+			if out.StatusCode != 200 {
+				return fmt.Errorf("%d %s", out.StatusCode, artifact.Path)
+			}
+			f, err := os.Create(path)
+			if err != nil {
+				return err
+			}
+			_, err = io.Copy(f, out.Body)
+			if err != nil {
+				_ = f.Close()
+				return err
+			}
+			return f.Close()
+		})
+		if err != nil {
+			c.opts.Logger.Println("error:", err)
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *client) Batch(ctx context.Context, batchReq *BatchPostRequest) (*BatchPostResponse, error) {
+	_, err := batchReq.Expand()
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(batchReq)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > MaxBatchPostBytes {
+		return nil, fmt.Errorf("batch is %d bytes, more than %d", len(data), MaxBatchPostBytes)
+	}
+	// retries of the post reuse the key, so a lost response cannot start a second group
+	batchResp := &BatchPostResponse{}
+	err = c.doHeaders(ctx, http.MethodPost, "/api/exec/batch", map[string]string{IdempotencyKeyHeader: RandKey()}, data, batchResp)
+	if err != nil {
+		return nil, err
+	}
+	return batchResp, nil
+}
+
+func (c *client) Group(ctx context.Context, id string) (*GroupStatus, error) {
+	status := &GroupStatus{}
+	err := c.do(ctx, http.MethodGet, fmt.Sprintf("/api/groups/%s", id), nil, status)
+	if err != nil {
+		return nil, err
+	}
+	return status, nil
+}
+
+func (c *client) WaitGroup(ctx context.Context, id string) (*GroupStatus, error) {
+	for {
+		status, err := c.Group(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if status.Done {
+			return status, nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(c.opts.PollInterval):
+		}
+	}
+}
+
+func (c *client) CancelGroup(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodDelete, fmt.Sprintf("/api/groups/%s", id), nil, nil)
+}
+
+func (c *client) AddSchedule(ctx context.Context, scheduleReq *SchedulePostRequest) (*Schedule, error) {
+	err := scheduleReq.Validate()
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(scheduleReq)
+	if err != nil {
+		return nil, err
+	}
+	schedule := &Schedule{}
+	err = c.doHeaders(ctx, http.MethodPost, "/api/schedules", map[string]string{IdempotencyKeyHeader: RandKey()}, data, schedule)
+	if err != nil {
+		return nil, err
+	}
+	return schedule, nil
+}
+
+func (c *client) Schedules(ctx context.Context) ([]Schedule, error) {
+	schedulesResp := &SchedulesGetResponse{}
+	err := c.do(ctx, http.MethodGet, "/api/schedules", nil, schedulesResp)
+	if err != nil {
+		return nil, err
+	}
+	return schedulesResp.Schedules, nil
+}
+
+func (c *client) Schedule(ctx context.Context, id string) (*ScheduleGetResponse, error) {
+	scheduleResp := &ScheduleGetResponse{}
+	err := c.do(ctx, http.MethodGet, fmt.Sprintf("/api/schedules/%s", id), nil, scheduleResp)
+	if err != nil {
+		return nil, err
+	}
+	return scheduleResp, nil
+}
+
+func (c *client) RemoveSchedule(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodDelete, fmt.Sprintf("/api/schedules/%s", id), nil, nil)
+}
+
+func (c *client) Webhook(ctx context.Context) (*WebhookGetResponse, error) {
+	webhookResp := &WebhookGetResponse{}
+	err := c.do(ctx, http.MethodGet, "/api/webhook", nil, webhookResp)
+	if err != nil {
+		return nil, err
+	}
+	return webhookResp, nil
+}
+
+func (c *client) SetWebhook(ctx context.Context, url string) (*WebhookGetResponse, error) {
+	err := ValidateWebhook(url)
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(WebhookPutRequest{Url: url})
+	if err != nil {
+		return nil, err
+	}
+	webhookResp := &WebhookGetResponse{}
+	err = c.do(ctx, http.MethodPut, "/api/webhook", data, webhookResp)
+	if err != nil {
+		return nil, err
+	}
+	return webhookResp, nil
+}
+
+func (c *client) RemoveWebhook(ctx context.Context) error {
+	return c.do(ctx, http.MethodDelete, "/api/webhook", nil, nil)
+}
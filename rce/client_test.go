@@ -0,0 +1,39 @@
+package rce
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestWaitCancel(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/exec/status":
+			_, _ = w.Write([]byte(`{"uid":"1.a","state":"running"}`))
+		case "/api/groups/g":
+			_, _ = w.Write([]byte(`{"id":"g","total":1,"running":1}`))
+		default:
+			w.WriteHeader(404)
+		}
+	}))
+	defer srv.Close()
+	client := newClient(ClientOptions{Url: srv.URL, PollInterval: time.Hour})
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := client.Wait(ctx, "1.a")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got: %v", err)
+	}
+	_, err = client.WaitGroup(ctx, "g")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got: %v", err)
+	}
+	if time.Since(start) > 10*time.Second {
+		t.Fatal("wait did not stop when its context was done")
+	}
+}
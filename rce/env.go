@@ -0,0 +1,50 @@
+package rce
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// parse KEY=VAL pairs into env, later values override earlier ones.
+func ParseEnv(env map[string]string, pairs []string) error {
+	for _, pair := range pairs {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return fmt.Errorf("env must be KEY=VAL, got: %s", pair)
+		}
+		env[parts[0]] = parts[1]
+	}
+	return nil
+}
+
+// read a dotenv style file into env. blank lines and lines starting
+// with # are ignored, an optional export prefix is dropped, and values
+// may be wrapped in single or double quotes.
+func ReadEnvFile(env map[string]string, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 {
+			return fmt.Errorf("%s:%d: expected KEY=VAL, got: %s", path, i+1, line)
+		}
+		key := strings.TrimSpace(parts[0])
+		val := strings.TrimSpace(parts[1])
+		if key == "" {
+			return fmt.Errorf("%s:%d: empty key", path, i+1)
+		}
+		if len(val) >= 2 && (val[0] == '"' || val[0] == '\'') && val[len(val)-1] == val[0] {
+			val = val[1 : len(val)-1]
+		}
+		env[key] = val
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package rce
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// non 200 responses from the api are returned as *APIError, which
+// matches these via errors.Is. use errors.As to get the status code,
+// body, or RetryAfter.
+var (
+	ErrUnauthorized = errors.New("unauthorized")
+	ErrBadRequest   = errors.New("bad request")
+	ErrNotFound     = errors.New("not found")
+	ErrRateLimited  = errors.New("rate limited")
+	ErrConflict     = errors.New("conflict")
+)
+
+// returned by the client when a job it follows has had no heartbeat
+// for ClientOptions.HeartbeatTimeout
+var ErrNoHeartbeat = errors.New("no heartbeat")
+
+// error codes of ErrorResponse
+const (
+	CodeBadRequest    = "bad-request"
+	CodeUnauthorized  = "unauthorized"
+	CodeNotFound      = "not-found"
+	CodeConflict      = "conflict"
+	CodeInternalError = "internal-error"
+)
+
+// the body of every api error. request_id is logged server side with
+// the details of the error.
+type ErrorResponse struct {
+	Code      string `json:"code"`
+	Message   string `json:"message"`
+	RequestId string `json:"request_id"`
+}
+
+// Code, Message, and RequestId are set if the body was an ErrorResponse
+type APIError struct {
+	StatusCode int
+	Url        string
+	Body       string
+	Code       string
+	Message    string
+	RequestId  string
+	RetryAfter time.Duration // from the retry-after header of a 429, zero if absent
+}
+
+func (e *APIError) Error() string {
+	msg := fmt.Sprintf("%d %s", e.StatusCode, e.Url)
+	if e.RetryAfter != 0 {
+		msg += fmt.Sprintf(" retry-after %s", e.RetryAfter)
+	}
+	if e.Code != "" {
+		return msg + fmt.Sprintf("\n%s: %s (request_id: %s)", e.Code, e.Message, e.RequestId)
+	}
+	body := strings.TrimSpace(e.Body)
+	if body != "" {
+		msg += "\n" + body
+	}
+	return msg
+}
+
+func (e *APIError) Unwrap() error {
+	switch e.StatusCode {
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return ErrUnauthorized
+	case http.StatusBadRequest:
+		return ErrBadRequest
+	case http.StatusNotFound:
+		return ErrNotFound
+	case http.StatusTooManyRequests:
+		return ErrRateLimited
+	case http.StatusConflict:
+		return ErrConflict
+	default:
+		return nil
+	}
+}
+
+func newAPIError(resp *http.Response, body []byte) *APIError {
+	apiErr := &APIError{
+		StatusCode: resp.StatusCode,
+		Url:        resp.Request.URL.String(),
+		Body:       string(body),
+	}
+	errResp := ErrorResponse{}
+	if json.Unmarshal(body, &errResp) == nil {
+		apiErr.Code = errResp.Code
+		apiErr.Message = errResp.Message
+		apiErr.RequestId = errResp.RequestId
+	}
+	if resp.StatusCode == http.StatusTooManyRequests {
+		apiErr.RetryAfter = parseRetryAfter(resp.Header.Get("Retry-After"))
+	}
+	return apiErr
+}
+
+// retry-after is either seconds or an http date
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	seconds, err := strconv.Atoi(value)
+	if err == nil {
+		return time.Duration(seconds) * time.Second
+	}
+	date, err := http.ParseTime(value)
+	if err == nil {
+		return time.Until(date).Round(time.Second)
+	}
+	return 0
+}
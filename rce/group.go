@@ -0,0 +1,185 @@
+package rce
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const (
+	MaxBatchJobs      = 100             // one dynamodb batch get covers a group
+	MaxBatchPostBytes = 1024 * 1024 * 5 // lambda payloads are limited to 6MB
+)
+
+// a batch is either a list of jobs, or a template job and a matrix of
+// env vars. the matrix is expanded to one job per combination of
+// values, each with the template's env plus one value of every key.
+// push urls are written by a single job, so a template cannot have
+// them, and jobs cannot share them. uploads are only read, so every
+// job of a template gets its stdin upload and workspace.
+type BatchPostRequest struct {
+	Jobs     []ExecPostRequest   `json:"jobs,omitempty"`
+	Template *ExecPostRequest    `json:"template,omitempty"`
+	Matrix   map[string][]string `json:"matrix,omitempty"`
+}
+
+type BatchPostResponse struct {
+	GroupId string   `json:"group-id"`
+	Uids    []string `json:"uids"`
+}
+
+// stored in dynamodb as group.<id>
+type GroupRecordData struct {
+	AuthName  string   `json:"auth-name"`
+	Uids      []string `json:"uids"`
+	Submitted int64    `json:"submitted"`
+	Ttl       int64    `json:"ttl"`
+}
+
+type GroupRecord struct {
+	RecordKey
+	GroupRecordData
+}
+
+func GroupRecordID(id string) string {
+	return fmt.Sprintf("group.%s", id)
+}
+
+// passed and failed are finished and failed jobs. done is true once
+// every job has exited.
+type GroupStatus struct {
+	Id        string      `json:"id"`
+	Total     int         `json:"total"`
+	Submitted int         `json:"submitted"`
+	Running   int         `json:"running"`
+	Passed    int         `json:"passed"`
+	Failed    int         `json:"failed"`
+	Done      bool        `json:"done"`
+	Jobs      []JobStatus `json:"jobs"`
+}
+
+func NewGroupStatus(id string, jobs []JobStatus) *GroupStatus {
+	status := &GroupStatus{
+		Id:    id,
+		Total: len(jobs),
+		Jobs:  jobs,
+	}
+	for _, job := range jobs {
+		switch job.State {
+		case StateSubmitted:
+			status.Submitted++
+		case StateRunning:
+			status.Running++
+		case StateFinished:
+			status.Passed++
+		case StateFailed:
+			status.Failed++
+		default:
+		}
+	}
+	status.Done = status.Passed+status.Failed == status.Total
+	return status
+}
+
+// group ids look like uids
+func ValidateGroupId(id string) error {
+	if !uidPattern.MatchString(id) {
+		return fmt.Errorf("bad group id: %q", id)
+	}
+	return nil
+}
+
+// expand a batch into the jobs to submit, validating each
+func (r *BatchPostRequest) Expand() ([]ExecPostRequest, error) {
+	var jobs []ExecPostRequest
+	switch {
+	case len(r.Jobs) > 0 && r.Template == nil && len(r.Matrix) == 0:
+		jobs = r.Jobs
+	case len(r.Jobs) == 0 && r.Template != nil && len(r.Matrix) > 0:
+		if r.Template.PushUrls != nil {
+			return nil, fmt.Errorf("template cannot have push-urls, use a list of jobs")
+		}
+		var keys []string
+		total := 1
+		for k, values := range r.Matrix {
+			if len(values) == 0 {
+				return nil, fmt.Errorf("matrix key has no values: %s", k)
+			}
+			keys = append(keys, k)
+			total *= len(values)
+			if total > MaxBatchJobs {
+				return nil, fmt.Errorf("matrix expands to more than %d jobs", MaxBatchJobs)
+			}
+		}
+		sort.Strings(keys)
+		combos := []map[string]string{{}}
+		for _, k := range keys {
+			var next []map[string]string
+			for _, combo := range combos {
+				for _, v := range r.Matrix[k] {
+					env := map[string]string{}
+					for ck, cv := range combo {
+						env[ck] = cv
+					}
+					env[k] = v
+					next = append(next, env)
+				}
+			}
+			combos = next
+		}
+		for _, combo := range combos {
+			job := *r.Template
+			job.Env = map[string]string{}
+			for k, v := range r.Template.Env {
+				job.Env[k] = v
+			}
+			for k, v := range combo {
+				job.Env[k] = v
+			}
+			jobs = append(jobs, job)
+		}
+	default:
+		return nil, fmt.Errorf("batch needs either jobs, or a template and a matrix")
+	}
+	if len(jobs) > MaxBatchJobs {
+		return nil, fmt.Errorf("more than %d jobs", MaxBatchJobs)
+	}
+	pushUrls := map[string]bool{}
+	for i := range jobs {
+		err := jobs[i].Validate()
+		if err != nil {
+			return nil, fmt.Errorf("job %d: %w", i, err)
+		}
+		if jobs[i].PushUrls != nil {
+			for _, url := range []string{jobs[i].PushUrls.Log, jobs[i].PushUrls.Exit, jobs[i].PushUrls.Size} {
+				if pushUrls[url] {
+					return nil, fmt.Errorf("job %d: push-urls are used by another job", i)
+				}
+				pushUrls[url] = true
+			}
+		}
+	}
+	return jobs, nil
+}
+
+// parse KEY=v1,v2 pairs into a matrix
+func ParseMatrix(pairs []string) (map[string][]string, error) {
+	matrix := map[string][]string{}
+	for _, pair := range pairs {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("bad matrix, expected KEY=v1,v2: %s", pair)
+		}
+		matrix[parts[0]] = append(matrix[parts[0]], strings.Split(parts[1], ",")...)
+	}
+	return matrix, nil
+}
+
+func Batch(ctx context.Context, url, auth string, batchReq *BatchPostRequest) (*BatchPostResponse, error) {
+	return NewGroupClient(ClientOptions{Url: url, Auth: auth}).Batch(ctx, batchReq)
+}
+
+func Group(ctx context.Context, url, auth, id string) (*GroupStatus, error) {
+	return NewGroupClient(ClientOptions{Url: url, Auth: auth}).Group(ctx, id)
+}
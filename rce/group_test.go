@@ -0,0 +1,141 @@
+package rce
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestBatchExpand(t *testing.T) {
+	pushUrls := func(name string) *PushUrls {
+		return &PushUrls{Log: "https://x/" + name + "/log", Exit: "https://x/" + name + "/exit", Size: "https://x/" + name + "/size"}
+	}
+	tests := []struct {
+		name string
+		req  BatchPostRequest
+		envs []map[string]string
+		err  string
+	}{
+		{
+			name: "jobs",
+			req:  BatchPostRequest{Jobs: []ExecPostRequest{{Argv: []string{"a"}}, {Argv: []string{"b"}, Env: map[string]string{"K": "v"}}}},
+			envs: []map[string]string{nil, {"K": "v"}},
+		},
+		{
+			name: "matrix",
+			req: BatchPostRequest{
+				Template: &ExecPostRequest{Argv: []string{"test"}, Env: map[string]string{"BASE": "1", "OS": "none"}},
+				Matrix:   map[string][]string{"OS": {"linux", "mac"}, "GO": {"1.17", "1.18"}},
+			},
+			envs: []map[string]string{
+				{"BASE": "1", "GO": "1.17", "OS": "linux"},
+				{"BASE": "1", "GO": "1.17", "OS": "mac"},
+				{"BASE": "1", "GO": "1.18", "OS": "linux"},
+				{"BASE": "1", "GO": "1.18", "OS": "mac"},
+			},
+		},
+		{
+			name: "jobs with their own push urls",
+			req:  BatchPostRequest{Jobs: []ExecPostRequest{{Argv: []string{"a"}, PushUrls: pushUrls("a")}, {Argv: []string{"b"}, PushUrls: pushUrls("b")}}},
+			envs: []map[string]string{nil, nil},
+		},
+		{
+			name: "empty",
+			req:  BatchPostRequest{},
+			err:  "either jobs, or a template and a matrix",
+		},
+		{
+			name: "jobs and template",
+			req:  BatchPostRequest{Jobs: []ExecPostRequest{{Argv: []string{"a"}}}, Template: &ExecPostRequest{Argv: []string{"a"}}, Matrix: map[string][]string{"K": {"v"}}},
+			err:  "either jobs, or a template and a matrix",
+		},
+		{
+			name: "template without matrix",
+			req:  BatchPostRequest{Template: &ExecPostRequest{Argv: []string{"a"}}},
+			err:  "either jobs, or a template and a matrix",
+		},
+		{
+			name: "matrix key without values",
+			req:  BatchPostRequest{Template: &ExecPostRequest{Argv: []string{"a"}}, Matrix: map[string][]string{"K": {}}},
+			err:  "no values",
+		},
+		{
+			name: "matrix too large",
+			req: BatchPostRequest{Template: &ExecPostRequest{Argv: []string{"a"}}, Matrix: map[string][]string{
+				"A": strings.Split("0,1,2,3,4,5,6,7,8,9,10", ","),
+				"B": strings.Split("0,1,2,3,4,5,6,7,8,9", ","),
+			}},
+			err: "more than 100 jobs",
+		},
+		{
+			name: "too many jobs",
+			req:  BatchPostRequest{Jobs: make([]ExecPostRequest, MaxBatchJobs+1)},
+			err:  "more than 100 jobs",
+		},
+		{
+			name: "invalid job",
+			req:  BatchPostRequest{Jobs: []ExecPostRequest{{Argv: []string{"a"}}, {}}},
+			err:  "job 1:",
+		},
+		{
+			name: "template with push urls",
+			req:  BatchPostRequest{Template: &ExecPostRequest{Argv: []string{"a"}, PushUrls: pushUrls("a")}, Matrix: map[string][]string{"K": {"1", "2"}}},
+			err:  "template cannot have push-urls",
+		},
+		{
+			name: "jobs sharing push urls",
+			req:  BatchPostRequest{Jobs: []ExecPostRequest{{Argv: []string{"a"}, PushUrls: pushUrls("a")}, {Argv: []string{"b"}, PushUrls: pushUrls("a")}}},
+			err:  "job 1: push-urls are used by another job",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			jobs, err := test.req.Expand()
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("expected error containing %q, got: %v", test.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var envs []map[string]string
+			for _, job := range jobs {
+				envs = append(envs, job.Env)
+			}
+			if !reflect.DeepEqual(envs, test.envs) {
+				t.Fatalf("got %v, expected %v", envs, test.envs)
+			}
+		})
+	}
+}
+
+func TestBatchExpandCopiesTemplateEnv(t *testing.T) {
+	template := &ExecPostRequest{Argv: []string{"a"}, Env: map[string]string{"BASE": "1"}}
+	jobs, err := (&BatchPostRequest{Template: template, Matrix: map[string][]string{"K": {"1", "2"}}}).Expand()
+	if err != nil {
+		t.Fatal(err)
+	}
+	jobs[0].Env["BASE"] = "changed"
+	if jobs[1].Env["BASE"] != "1" || template.Env["BASE"] != "1" {
+		t.Fatalf("jobs share the template env")
+	}
+}
+
+func TestParseMatrix(t *testing.T) {
+	matrix, err := ParseMatrix([]string{"OS=linux,mac", "GO=1.17", "OS=win"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string][]string{"OS": {"linux", "mac", "win"}, "GO": {"1.17"}}
+	if !reflect.DeepEqual(matrix, expected) {
+		t.Fatalf("got %v", matrix)
+	}
+	for _, bad := range []string{"OS", "=x"} {
+		_, err := ParseMatrix([]string{bad})
+		if err == nil {
+			t.Fatalf("expected error for %q", bad)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package rce
+
+import (
+	"fmt"
+	"time"
+)
+
+// a post to /api/exec with an idempotency key starts at most one job
+// per key. a repeat post with the same key and body returns the uid of
+// the first, with the replayed header set. a repeat post while the first
+// is still submitting gets 409, and should be retried.
+const (
+	IdempotencyKeyHeader     = "Idempotency-Key"
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+	MaxIdempotencyKeyBytes   = 255
+	IdempotencyKeyTtl        = 24 * time.Hour
+	IdempotencyClaimTimeout  = 30 * time.Second // a claim older than this is from a failed request, and a repeat post takes it over
+)
+
+// the state of an idempotency record. the first request claims the key,
+// then marks it submitted once its job is.
+const (
+	IdempotencyClaimed   = "claimed"
+	IdempotencySubmitted = "submitted"
+)
+
+// stored in dynamodb as idempotency.<auth-name>.<key>. ttl is unix
+// seconds, after which dynamodb deletes the record and the key can
+// start a new job. claimed is the unix millis of the current claim.
+type IdempotencyRecordData struct {
+	Uid         string `json:"uid"`
+	RequestHash string `json:"request-hash"`
+	State       string `json:"state"`
+	Claimed     int64  `json:"claimed"`
+	Ttl         int64  `json:"ttl"`
+}
+
+type IdempotencyRecord struct {
+	RecordKey
+	IdempotencyRecordData
+}
+
+func IdempotencyRecordID(authName, key string) string {
+	return fmt.Sprintf("idempotency.%s.%s", authName, key)
+}
+
+func ValidateIdempotencyKey(key string) error {
+	if key == "" || len(key) > MaxIdempotencyKeyBytes {
+		return fmt.Errorf("%s must be 1 to %d bytes", IdempotencyKeyHeader, MaxIdempotencyKeyBytes)
+	}
+	for _, r := range key {
+		if r < 0x21 || r > 0x7e {
+			return fmt.Errorf("%s must be printable ascii without spaces", IdempotencyKeyHeader)
+		}
+	}
+	return nil
+}
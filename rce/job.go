@@ -0,0 +1,259 @@
+package rce
+
+import (
+	"context"
+	"fmt"
+	neturl "net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nathants/libaws/lib"
+)
+
+// a job is submitted by the api, running once the async lambda starts
+// it, and finished or failed once exit is written. failed means a non
+// zero exit, including cancel and timeout.
+const (
+	StateSubmitted = "submitted"
+	StateRunning   = "running"
+	StateFinished  = "finished"
+	StateFailed    = "failed"
+)
+
+type JobStatus struct {
+	Uid       string            `json:"uid"`
+	AuthName  string            `json:"auth-name"`
+	State     string            `json:"state"`
+	Argv      []string          `json:"argv"`
+	Submitted time.Time         `json:"submitted"`
+	Started   *time.Time        `json:"started,omitempty"`
+	Ended     *time.Time        `json:"ended,omitempty"`
+	Duration  float64           `json:"duration"` // seconds from started until ended, or until now while running
+	Exit      *int              `json:"exit,omitempty"`
+	Signal    string            `json:"signal,omitempty"`
+	Reason    string            `json:"reason,omitempty"`
+	Group     string            `json:"group,omitempty"`
+	Schedule  string            `json:"schedule,omitempty"`
+	Heartbeat *time.Time        `json:"heartbeat,omitempty"` // last sign of life from the async lambda, unset once the job exits
+	Webhook   string            `json:"webhook,omitempty"`
+	Webhooks  []WebhookDelivery `json:"webhook-deliveries,omitempty"`
+}
+
+// stored in dynamodb as job.<uid>. times are unix millis so that
+// submitted can be the range key of the jobs index, which is keyed by
+// auth-name. ttl is unix seconds, after which dynamodb deletes the
+// record. logs and other objects are under prefix in s3, and expire
+// sooner than the record. active is set until the job exits, which
+// with heartbeat keys the sparse active index, so the scheduled event
+// can find jobs whose heartbeat went stale.
+type JobRecordData struct {
+	AuthName  string            `json:"auth-name"`
+	Ip        string            `json:"ip"`
+	State     string            `json:"state"`
+	Argv      []string          `json:"argv"`
+	Submitted int64             `json:"submitted"`
+	Started   int64             `json:"started,omitempty"`
+	Ended     int64             `json:"ended,omitempty"`
+	Exit      *int              `json:"exit,omitempty"`
+	Signal    string            `json:"signal,omitempty"`
+	Reason    string            `json:"reason,omitempty"`
+	LogSize   int               `json:"log-size"`
+	Prefix    string            `json:"prefix"`
+	Ttl       int64             `json:"ttl"`
+	Group     string            `json:"group,omitempty"`
+	Schedule  string            `json:"schedule,omitempty"` // id of the schedule that ran the job
+	Active    string            `json:"active,omitempty"`
+	Heartbeat int64             `json:"heartbeat,omitempty"`
+	Webhook   string            `json:"webhook,omitempty"`
+	Webhooks  []WebhookDelivery `json:"webhook-deliveries,omitempty"`
+}
+
+type JobRecord struct {
+	RecordKey
+	JobRecordData
+}
+
+const (
+	JobsIndex   = "jobs"
+	ActiveIndex = "active"
+	ActiveShard = "0" // every active job record is in one partition of the active index
+)
+
+func JobRecordID(uid string) string {
+	return fmt.Sprintf("job.%s", uid)
+}
+
+func (r *JobRecord) Status() *JobStatus {
+	status := &JobStatus{
+		Uid:       strings.TrimPrefix(r.ID, "job."),
+		AuthName:  r.AuthName,
+		State:     r.State,
+		Argv:      r.Argv,
+		Submitted: lib.FromUnixMilli(r.Submitted).UTC(),
+		Exit:      r.Exit,
+		Signal:    r.Signal,
+		Reason:    r.Reason,
+		Group:     r.Group,
+		Schedule:  r.Schedule,
+		Webhook:   r.Webhook,
+		Webhooks:  r.Webhooks,
+	}
+	if r.Started != 0 {
+		started := lib.FromUnixMilli(r.Started).UTC()
+		status.Started = &started
+		status.Duration = time.Since(started).Seconds()
+	}
+	if r.Active != "" && r.Heartbeat != 0 {
+		heartbeat := lib.FromUnixMilli(r.Heartbeat).UTC()
+		status.Heartbeat = &heartbeat
+	}
+	if r.Ended != 0 {
+		ended := lib.FromUnixMilli(r.Ended).UTC()
+		status.Ended = &ended
+		if status.Started != nil {
+			status.Duration = ended.Sub(*status.Started).Seconds()
+		}
+	}
+	return status
+}
+
+// get the lifecycle state of a job.
+func Status(ctx context.Context, url, auth, uid string) (*JobStatus, error) {
+	return NewClient(ClientOptions{Url: url, Auth: auth}).Status(ctx, uid)
+}
+
+const (
+	DefaultJobsLimit = 50
+	MaxJobsLimit     = 200
+)
+
+// filters for listing jobs, all optional. since and until bound the
+// submitted time, argv matches a substring of the space joined argv,
+// schedule matches jobs run by a schedule, and next continues from a
+// previous page.
+type JobsQuery struct {
+	State    string
+	Exit     *int
+	Since    time.Time
+	Until    time.Time
+	Argv     string
+	Schedule string
+	Limit    int
+	Next     string
+}
+
+type JobsGetResponse struct {
+	Jobs []JobStatus `json:"jobs"`
+	Next string      `json:"next,omitempty"`
+}
+
+func (q JobsQuery) Values() neturl.Values {
+	vals := neturl.Values{}
+	if q.State != "" {
+		vals.Set("state", q.State)
+	}
+	if q.Exit != nil {
+		vals.Set("exit", fmt.Sprint(*q.Exit))
+	}
+	if !q.Since.IsZero() {
+		vals.Set("since", fmt.Sprint(q.Since.Unix()))
+	}
+	if !q.Until.IsZero() {
+		vals.Set("until", fmt.Sprint(q.Until.Unix()))
+	}
+	if q.Argv != "" {
+		vals.Set("argv", q.Argv)
+	}
+	if q.Schedule != "" {
+		vals.Set("schedule", q.Schedule)
+	}
+	if q.Limit != 0 {
+		vals.Set("limit", fmt.Sprint(q.Limit))
+	}
+	if q.Next != "" {
+		vals.Set("next", q.Next)
+	}
+	return vals
+}
+
+func ParseJobsQuery(params map[string]string) (JobsQuery, error) {
+	q := JobsQuery{
+		State:    params["state"],
+		Argv:     params["argv"],
+		Schedule: params["schedule"],
+		Next:     params["next"],
+		Limit:    DefaultJobsLimit,
+	}
+	switch q.State {
+	case "", StateSubmitted, StateRunning, StateFinished, StateFailed:
+	default:
+		return q, fmt.Errorf("bad state: %s", q.State)
+	}
+	if params["exit"] != "" {
+		exit, err := strconv.Atoi(params["exit"])
+		if err != nil {
+			return q, fmt.Errorf("bad exit: %s", params["exit"])
+		}
+		q.Exit = &exit
+	}
+	for _, k := range []string{"since", "until"} {
+		if params[k] == "" {
+			continue
+		}
+		unix, err := strconv.ParseInt(params[k], 10, 64)
+		if err != nil {
+			return q, fmt.Errorf("bad %s, expected unix seconds: %s", k, params[k])
+		}
+		if k == "since" {
+			q.Since = time.Unix(unix, 0)
+		} else {
+			q.Until = time.Unix(unix, 0)
+		}
+	}
+	if params["limit"] != "" {
+		limit, err := strconv.Atoi(params["limit"])
+		if err != nil || limit < 1 {
+			return q, fmt.Errorf("bad limit: %s", params["limit"])
+		}
+		if limit > MaxJobsLimit {
+			limit = MaxJobsLimit
+		}
+		q.Limit = limit
+	}
+	return q, nil
+}
+
+// whether the query filters on more than time, so it may read many
+// jobs per match
+func (q JobsQuery) Filtered() bool {
+	return q.State != "" || q.Exit != nil || q.Argv != "" || q.Schedule != ""
+}
+
+// whether a job matches the state, exit, time, argv, and schedule filters
+func (q JobsQuery) Match(status *JobStatus) bool {
+	if q.State != "" && status.State != q.State {
+		return false
+	}
+	if q.Exit != nil && (status.Exit == nil || *status.Exit != *q.Exit) {
+		return false
+	}
+	if !q.Since.IsZero() && status.Submitted.Before(q.Since) {
+		return false
+	}
+	if !q.Until.IsZero() && status.Submitted.After(q.Until) {
+		return false
+	}
+	if q.Argv != "" && !strings.Contains(strings.Join(status.Argv, " "), q.Argv) {
+		return false
+	}
+	if q.Schedule != "" && status.Schedule != q.Schedule {
+		return false
+	}
+	return true
+}
+
+// list jobs for this auth, newest first.
+func Jobs(ctx context.Context, url, auth string, query JobsQuery) (*JobsGetResponse, error) {
+	return NewJobsClient(ClientOptions{Url: url, Auth: auth}).Jobs(ctx, query)
+}
@@ -0,0 +1,71 @@
+package rce
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+)
+
+// the log is a sequence of frames, each a header line of
+// "<stream> <length>\n" followed by length bytes of data. stream is
+// the file descriptor the data was written to, messages from aws-rce
+// itself are written to stderr.
+const (
+	Stdout = 1
+	Stderr = 2
+)
+
+type Frame struct {
+	Stream int
+	Data   []byte
+}
+
+func EncodeFrame(stream int, data []byte) []byte {
+	header := fmt.Sprintf("%d %d\n", stream, len(data))
+	return append([]byte(header), data...)
+}
+
+// decode a frame header line, without its newline
+func DecodeFrameHeader(line []byte) (int, int, error) {
+	header := bytes.SplitN(line, []byte(" "), 2)
+	if len(header) != 2 {
+		return 0, 0, fmt.Errorf("bad frame header: %q", line)
+	}
+	stream, err := strconv.Atoi(string(header[0]))
+	if err != nil {
+		return 0, 0, fmt.Errorf("bad frame stream: %q", line)
+	}
+	size, err := strconv.Atoi(string(header[1]))
+	if err != nil || size < 0 {
+		return 0, 0, fmt.Errorf("bad frame length: %q", line)
+	}
+	return stream, size, nil
+}
+
+// decode the complete frames at the start of data, returning them and
+// the number of bytes they used. a trailing partial frame is left for
+// the caller to retry with more data.
+func DecodeFrames(data []byte) ([]Frame, int, error) {
+	var frames []Frame
+	offset := 0
+	for {
+		newline := bytes.IndexByte(data[offset:], '\n')
+		if newline == -1 {
+			return frames, offset, nil
+		}
+		stream, size, err := DecodeFrameHeader(data[offset : offset+newline])
+		if err != nil {
+			return frames, offset, fmt.Errorf("%w at offset %d", err, offset)
+		}
+		start := offset + newline + 1
+		end := start + size
+		if end > len(data) {
+			return frames, offset, nil
+		}
+		frames = append(frames, Frame{
+			Stream: stream,
+			Data:   data[start:end],
+		})
+		offset = end
+	}
+}
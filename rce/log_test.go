@@ -0,0 +1,88 @@
+package rce
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestDecodeFrames(t *testing.T) {
+	invalid := []byte{0xff, 0xe2, 0x82}
+	tests := []struct {
+		name     string
+		data     []byte
+		frames   []Frame
+		consumed int
+		err      bool
+	}{
+		{"empty", nil, nil, 0, false},
+		{"one frame", EncodeFrame(Stdout, []byte("hello\n")), []Frame{{Stdout, []byte("hello\n")}}, 10, false},
+		{"empty frame", EncodeFrame(Stderr, nil), []Frame{{Stderr, []byte{}}}, 4, false},
+		{
+			"two streams",
+			append(EncodeFrame(Stdout, []byte("a")), EncodeFrame(Stderr, []byte("b\n"))...),
+			[]Frame{{Stdout, []byte("a")}, {Stderr, []byte("b\n")}},
+			11,
+			false,
+		},
+		{"newline in data", EncodeFrame(Stdout, []byte("a\nb\n")), []Frame{{Stdout, []byte("a\nb\n")}}, 8, false},
+		{"invalid utf8", EncodeFrame(Stdout, invalid), []Frame{{Stdout, invalid}}, 7, false},
+		{"partial header", []byte("1 5"), nil, 0, false},
+		{"partial data", []byte("1 5\nabc"), nil, 0, false},
+		{
+			"trailing partial frame",
+			append(EncodeFrame(Stdout, []byte("a")), []byte("2 10\nabc")...),
+			[]Frame{{Stdout, []byte("a")}},
+			5,
+			false,
+		},
+		{"bad header", []byte("x\n"), nil, 0, true},
+		{"bad stream", []byte("x 1\na"), nil, 0, true},
+		{"bad length", []byte("1 x\na"), nil, 0, true},
+		{"negative length", []byte("1 -1\na"), nil, 0, true},
+		{
+			"error after a frame",
+			append(EncodeFrame(Stdout, []byte("a")), []byte("junk\n")...),
+			[]Frame{{Stdout, []byte("a")}},
+			5,
+			true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			frames, consumed, err := DecodeFrames(test.data)
+			if (err != nil) != test.err {
+				t.Fatalf("err: %v", err)
+			}
+			if consumed != test.consumed {
+				t.Fatalf("consumed %d, expected %d", consumed, test.consumed)
+			}
+			if len(frames) != len(test.frames) {
+				t.Fatalf("got %d frames, expected %d", len(frames), len(test.frames))
+			}
+			for i := range frames {
+				if frames[i].Stream != test.frames[i].Stream || !bytes.Equal(frames[i].Data, test.frames[i].Data) {
+					t.Fatalf("frame %d: got %+v, expected %+v", i, frames[i], test.frames[i])
+				}
+			}
+		})
+	}
+}
+
+func TestEncodeDecodeFrames(t *testing.T) {
+	var data []byte
+	expected := []Frame{{Stdout, []byte("out")}, {Stderr, []byte("err\n")}, {Stdout, []byte{0, 1, 2}}}
+	for _, frame := range expected {
+		data = append(data, EncodeFrame(frame.Stream, frame.Data)...)
+	}
+	frames, consumed, err := DecodeFrames(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if consumed != len(data) {
+		t.Fatalf("consumed %d of %d", consumed, len(data))
+	}
+	if !reflect.DeepEqual(frames, expected) {
+		t.Fatalf("got %+v", frames)
+	}
+}
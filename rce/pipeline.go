@@ -0,0 +1,351 @@
+package rce
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// a pipeline file looks like:
+//
+//	upload: .
+//	env:
+//	  CI: "true"
+//	steps:
+//	  build:
+//	    argv: [make, build]
+//	  test:
+//	    argv: [make, test]
+//	    env: {SHARD: "1"}
+//	    timeout: 5m
+//	    needs: [build]
+//
+// upload is relative to the pipeline file, and is uploaded once as the
+// workspace of every step. top level env is set on every step, and step
+// env overrides it.
+type Pipeline struct {
+	Upload string            `yaml:"upload"`
+	Env    map[string]string `yaml:"env"`
+	Steps  []*PipelineStep   `yaml:"-"` // in file order
+}
+
+type PipelineStep struct {
+	Name     string            `yaml:"-"`
+	Argv     []string          `yaml:"argv"`
+	Env      map[string]string `yaml:"env"`
+	Dir      string            `yaml:"cwd"`
+	CleanEnv bool              `yaml:"clean-env"`
+	Timeout  string            `yaml:"timeout"` // like 30s or 5m
+	Needs    []string          `yaml:"needs"`
+}
+
+const (
+	StepPassed  = "passed"
+	StepFailed  = "failed"
+	StepSkipped = "skipped" // a step it needs did not pass
+)
+
+type StepResult struct {
+	Name     string        `json:"name"`
+	State    string        `json:"state"`
+	Uid      string        `json:"uid,omitempty"`
+	Exit     int           `json:"exit"`
+	Duration time.Duration `json:"duration"`
+	Err      error         `json:"-"` // set if the job could not be submitted or followed
+}
+
+func LoadPipeline(path string) (*Pipeline, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	pipeline, err := ParsePipeline(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if pipeline.Upload != "" && !filepath.IsAbs(pipeline.Upload) {
+		pipeline.Upload = filepath.Join(filepath.Dir(path), pipeline.Upload)
+	}
+	return pipeline, nil
+}
+
+// unknown keys are an error, so a typo like need: or dir: is not ignored
+func ParsePipeline(data []byte) (*Pipeline, error) {
+	// steps are decoded from the node so they keep their file order
+	var file struct {
+		Upload string            `yaml:"upload"`
+		Env    map[string]string `yaml:"env"`
+		Steps  yaml.Node         `yaml:"steps"`
+	}
+	err := decodeStrict(data, &file)
+	if err != nil {
+		return nil, err
+	}
+	pipeline := &Pipeline{
+		Upload: file.Upload,
+		Env:    file.Env,
+	}
+	if file.Steps.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("steps must be a map of name to step")
+	}
+	for i := 0; i+1 < len(file.Steps.Content); i += 2 {
+		name := file.Steps.Content[i].Value
+		// node.Decode ignores unknown keys, so re-encode the step to decode it strictly
+		stepData, err := yaml.Marshal(file.Steps.Content[i+1])
+		if err != nil {
+			return nil, err
+		}
+		step := &PipelineStep{}
+		err = decodeStrict(stepData, step)
+		if err != nil {
+			return nil, fmt.Errorf("step %s: %w", name, err)
+		}
+		step.Name = name
+		pipeline.Steps = append(pipeline.Steps, step)
+	}
+	err = pipeline.Validate()
+	if err != nil {
+		return nil, err
+	}
+	return pipeline, nil
+}
+
+func decodeStrict(data []byte, val interface{}) error {
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	err := decoder.Decode(val)
+	if err == io.EOF {
+		return nil
+	}
+	return err
+}
+
+func (p *Pipeline) Validate() error {
+	if len(p.Steps) == 0 {
+		return fmt.Errorf("pipeline has no steps")
+	}
+	steps := map[string]*PipelineStep{}
+	for _, step := range p.Steps {
+		if step.Name == "" {
+			return fmt.Errorf("step has no name")
+		}
+		if steps[step.Name] != nil {
+			return fmt.Errorf("duplicate step: %s", step.Name)
+		}
+		steps[step.Name] = step
+		if len(step.Argv) == 0 {
+			return fmt.Errorf("step %s: argv is required", step.Name)
+		}
+		if step.Timeout != "" {
+			_, err := time.ParseDuration(step.Timeout)
+			if err != nil {
+				return fmt.Errorf("step %s: bad timeout: %w", step.Name, err)
+			}
+		}
+	}
+	for _, step := range p.Steps {
+		for _, need := range step.Needs {
+			if steps[need] == nil {
+				return fmt.Errorf("step %s: needs unknown step: %s", step.Name, need)
+			}
+		}
+	}
+	// depth first search for cycles, 1 is visiting and 2 is visited
+	seen := map[string]int{}
+	var visit func(name string) error
+	visit = func(name string) error {
+		switch seen[name] {
+		case 1:
+			return fmt.Errorf("step %s: needs form a cycle", name)
+		case 2:
+			return nil
+		default:
+		}
+		seen[name] = 1
+		for _, need := range steps[name].Needs {
+			err := visit(need)
+			if err != nil {
+				return err
+			}
+		}
+		seen[name] = 2
+		return nil
+	}
+	for _, step := range p.Steps {
+		err := visit(step.Name)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *Pipeline) execRequest(step *PipelineStep, workspace string) (*ExecPostRequest, error) {
+	execReq := &ExecPostRequest{
+		Argv:      step.Argv,
+		Env:       map[string]string{},
+		Dir:       step.Dir,
+		CleanEnv:  step.CleanEnv,
+		Workspace: workspace,
+	}
+	for k, v := range p.Env {
+		execReq.Env[k] = v
+	}
+	for k, v := range step.Env {
+		execReq.Env[k] = v
+	}
+	if step.Timeout != "" {
+		timeout, err := time.ParseDuration(step.Timeout)
+		if err != nil {
+			return nil, err
+		}
+		execReq.Timeout = int(math.Ceil(timeout.Seconds()))
+	}
+	return execReq, nil
+}
+
+// run each step as a job once the steps it needs have passed, with
+// independent steps running concurrently. output lines are written to
+// stdout and stderr prefixed with the step name. when ctx is cancelled,
+// running jobs are cancelled and waited on, and steps not yet started
+// are skipped. results are in file order. files uploads the workspace.
+func RunPipeline(ctx context.Context, client Client, files FileClient, pipeline *Pipeline, stdout, stderr io.Writer) ([]*StepResult, error) {
+	workspace := ""
+	if pipeline.Upload != "" {
+		var err error
+		workspace, err = files.UploadWorkspace(ctx, pipeline.Upload)
+		if err != nil {
+			return nil, err
+		}
+	}
+	width := 0
+	done := map[string]chan struct{}{}
+	results := map[string]*StepResult{}
+	for _, step := range pipeline.Steps {
+		done[step.Name] = make(chan struct{})
+		results[step.Name] = &StepResult{Name: step.Name}
+		if len(step.Name) > width {
+			width = len(step.Name)
+		}
+	}
+	var lock sync.Mutex
+	var wg sync.WaitGroup
+	for _, step := range pipeline.Steps {
+		wg.Add(1)
+		go func(step *PipelineStep) {
+			// defer func() {}()
+			defer wg.Done()
+			result := results[step.Name]
+			defer close(done[step.Name])
+			for _, need := range step.Needs {
+				<-done[need]
+				if results[need].State != StepPassed {
+					result.State = StepSkipped
+					return
+				}
+			}
+			if ctx.Err() != nil {
+				result.State = StepSkipped
+				return
+			}
+			prefix := fmt.Sprintf("%-*s | ", width, step.Name)
+			outWriter := &prefixWriter{w: stdout, lock: &lock, prefix: prefix}
+			errWriter := &prefixWriter{w: stderr, lock: &lock, prefix: prefix}
+			runStep(ctx, client, pipeline, step, workspace, result, outWriter, errWriter)
+			outWriter.flush()
+			errWriter.flush()
+		}(step)
+	}
+	wg.Wait()
+	var ordered []*StepResult
+	for _, step := range pipeline.Steps {
+		ordered = append(ordered, results[step.Name])
+	}
+	return ordered, nil
+}
+
+func runStep(ctx context.Context, client Client, pipeline *Pipeline, step *PipelineStep, workspace string, result *StepResult, stdout, stderr io.Writer) {
+	result.State = StepFailed
+	execReq, err := pipeline.execRequest(step, workspace)
+	if err != nil {
+		result.Err = err
+		return
+	}
+	uid, err := client.Submit(ctx, execReq)
+	if err != nil {
+		result.Err = err
+		return
+	}
+	result.Uid = uid
+	attached := make(chan struct{})
+	defer close(attached)
+	go func() {
+		// defer func() {}()
+		select {
+		case <-ctx.Done():
+			_ = client.Cancel(context.Background(), uid)
+		case <-attached:
+		}
+	}()
+	// attach outlives ctx, so a cancelled job is followed until it exits
+	execResult, err := client.Attach(context.Background(), uid, 0, stdout, stderr)
+	if err != nil {
+		result.Err = err
+		return
+	}
+	result.Exit = execResult.Exit
+	result.Duration = execResult.Duration
+	if execResult.Exit == 0 {
+		result.State = StepPassed
+	}
+}
+
+// prefixes each line written to w, holding a partial line until its
+// newline or flush. lock is shared by every writer of the pipeline so
+// lines from concurrent steps are not interleaved.
+type prefixWriter struct {
+	w      io.Writer
+	lock   *sync.Mutex
+	prefix string
+	buf    []byte
+}
+
+func (w *prefixWriter) Write(data []byte) (int, error) {
+	w.buf = append(w.buf, data...)
+	i := bytes.LastIndexByte(w.buf, '\n')
+	if i == -1 {
+		return len(data), nil
+	}
+	lines := w.buf[:i+1]
+	w.buf = append([]byte{}, w.buf[i+1:]...)
+	var out bytes.Buffer
+	scanner := bufio.NewScanner(bytes.NewReader(lines))
+	scanner.Buffer(make([]byte, 64*1024), len(lines)+1)
+	for scanner.Scan() {
+		out.WriteString(w.prefix)
+		out.Write(scanner.Bytes())
+		out.WriteByte('\n')
+	}
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	_, err := w.w.Write(out.Bytes())
+	if err != nil {
+		return 0, err
+	}
+	return len(data), nil
+}
+
+func (w *prefixWriter) flush() {
+	if len(w.buf) > 0 {
+		_, _ = w.Write([]byte("\n"))
+	}
+}
@@ -0,0 +1,115 @@
+package rce
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParsePipeline(t *testing.T) {
+	tests := []struct {
+		name  string
+		yaml  string
+		steps []string
+		err   string
+	}{
+		{
+			name: "in file order",
+			yaml: `
+upload: .
+env: {CI: "true"}
+steps:
+  test:
+    argv: [make, test]
+    needs: [build]
+  build:
+    argv: [make, build]
+    cwd: src
+    timeout: 5m
+`,
+			steps: []string{"test", "build"},
+		},
+		{name: "empty", yaml: "", err: "steps must be a map"},
+		{name: "steps is a list", yaml: "steps: [a, b]", err: "steps must be a map"},
+		{name: "no steps", yaml: "steps: {}", err: "no steps"},
+		{name: "unknown top level key", yaml: "stpes: {a: {argv: [x]}}", err: "field stpes not found"},
+		{name: "unknown step key", yaml: "steps: {a: {argv: [x]}, b: {argv: [y], need: [a]}}", err: "step b:"},
+		{name: "dir instead of cwd", yaml: "steps: {a: {argv: [x], dir: src}}", err: "field dir not found"},
+		{name: "no argv", yaml: "steps: {a: {}}", err: "argv is required"},
+		{name: "null step", yaml: "steps: {a: }", err: "argv is required"},
+		{name: "bad timeout", yaml: "steps: {a: {argv: [x], timeout: soon}}", err: "bad timeout"},
+		{name: "unknown need", yaml: "steps: {a: {argv: [x], needs: [b]}}", err: "needs unknown step: b"},
+		{name: "self cycle", yaml: "steps: {a: {argv: [x], needs: [a]}}", err: "cycle"},
+		{name: "cycle", yaml: "steps: {a: {argv: [x], needs: [c]}, b: {argv: [x], needs: [a]}, c: {argv: [x], needs: [b]}}", err: "cycle"},
+		{name: "duplicate step", yaml: "steps:\n  a: {argv: [x]}\n  a: {argv: [y]}\n", err: "duplicate step: a"},
+		{
+			name:  "diamond",
+			yaml:  "steps: {a: {argv: [x]}, b: {argv: [x], needs: [a]}, c: {argv: [x], needs: [a]}, d: {argv: [x], needs: [b, c]}}",
+			steps: []string{"a", "b", "c", "d"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			pipeline, err := ParsePipeline([]byte(test.yaml))
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("expected error containing %q, got: %v", test.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var names []string
+			for _, step := range pipeline.Steps {
+				names = append(names, step.Name)
+			}
+			if strings.Join(names, ",") != strings.Join(test.steps, ",") {
+				t.Fatalf("got steps %v, expected %v", names, test.steps)
+			}
+		})
+	}
+}
+
+func TestPipelineValidate(t *testing.T) {
+	step := func(name string, needs ...string) *PipelineStep {
+		return &PipelineStep{Name: name, Argv: []string{"x"}, Needs: needs}
+	}
+	tests := []struct {
+		name  string
+		steps []*PipelineStep
+		err   string
+	}{
+		{"chain", []*PipelineStep{step("a"), step("b", "a"), step("c", "b")}, ""},
+		{"needs a later step", []*PipelineStep{step("b", "a"), step("a")}, ""},
+		{"no name", []*PipelineStep{step("")}, "no name"},
+		{"duplicate", []*PipelineStep{step("a"), step("a")}, "duplicate step: a"},
+		{"two step cycle", []*PipelineStep{step("a", "b"), step("b", "a")}, "cycle"},
+		{"cycle after a valid chain", []*PipelineStep{step("a"), step("b", "a", "d"), step("c", "b"), step("d", "c")}, "cycle"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := (&Pipeline{Steps: test.steps}).Validate()
+			if test.err == "" && err != nil {
+				t.Fatal(err)
+			}
+			if test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)) {
+				t.Fatalf("expected error containing %q, got: %v", test.err, err)
+			}
+		})
+	}
+}
+
+func TestPipelineExecRequest(t *testing.T) {
+	pipeline := &Pipeline{Env: map[string]string{"A": "1", "B": "1"}}
+	step := &PipelineStep{Name: "s", Argv: []string{"x"}, Env: map[string]string{"B": "2"}, Timeout: "90s", Dir: "src"}
+	execReq, err := pipeline.execRequest(step, "ws")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if execReq.Env["A"] != "1" || execReq.Env["B"] != "2" {
+		t.Fatalf("bad env: %v", execReq.Env)
+	}
+	if execReq.Timeout != 90 || execReq.Dir != "src" || execReq.Workspace != "ws" {
+		t.Fatalf("bad request: %+v", execReq)
+	}
+}
@@ -1,35 +1,74 @@
 package rce
 
 import (
-	"bytes"
 	"context"
 	"crypto/rand"
 	"encoding/hex"
-	"encoding/json"
 	"fmt"
 	"io"
-	"net/http"
 	"strings"
 	"time"
 
-	"github.com/nathants/libaws/lib"
 	"golang.org/x/crypto/blake2b"
 )
 
 const (
-	EventExec       = "exec"
-	MaxLogBytes     = 1024 * 1024 * 32 // 30MB takes ~3s to write to s3 from 128mb lambda
-	LogShipInterval = 3 * time.Second
+	EventExec         = "exec"
+	EventWebhook      = "webhook"
+	MaxLogBytes       = 1024 * 1024 * 1024 // log is shipped as chunks, so each byte is written to s3 once
+	MaxLogChunkBytes  = 1024 * 1024 * 8    // ship early if a chunk gets this large before LogShipInterval
+	MaxLogChunksGet   = 16                 // chunk urls returned per get
+	MaxPushLogBytes   = 1024 * 1024 * 32   // push urls get the entire log each time, 30MB takes ~3s to write to s3 from 128mb lambda
+	LogShipInterval   = 3 * time.Second
+	CancelGracePeriod = 5 * time.Second   // time between sigterm and sigkill, on cancel or timeout
+	MaxTimeout        = 14 * time.Minute  // lambda timeout is 15 minutes, leave time to ship logs and artifacts
+	MaxInlineStdin    = 1024 * 128        // larger stdin is uploaded to s3, async lambda payloads are limited to 256KB
+	MaxStdinBytes     = 1024 * 1024 * 256 // stdin is read into memory before it is sent
+	UploadUrlExpire   = 10 * time.Minute
+	MaxLongPollWait   = 20                     // seconds a get may wait for new log, apigateway times out at 29
+	LongPollInterval  = 500 * time.Millisecond // time between checks for new log while waiting
+	MaxInlineLogBytes = 1024 * 256             // new log up to this size is returned inline instead of as chunk urls
+	HeartbeatInterval = 30 * time.Second       // the async lambda updates the job record this often while it runs
+	LostJobTimeout    = 5 * time.Minute        // the scheduled event marks a job lost when its heartbeat is older than this
+	HeartbeatTimeout  = 2 * LostJobTimeout     // default for ClientOptions, long enough for the scheduled event to mark the job lost first
+)
+
+const (
+	ExitReasonCancelled = "cancelled"
+	ExitReasonTimeout   = "timeout"
+	ExitReasonLost      = "lost" // the async lambda died without writing exit, see LostJobTimeout
+	ExitTimeout         = 124    // like coreutils timeout
+	ExitLost            = 125    // like coreutils timeout when it fails itself
 )
 
 type ExecGetRequest struct {
 	Uid        string `json:"uid"`
 	RangeStart int    `json:"range-start"`
+	Wait       *int   `json:"wait"` // seconds to wait for log past range-start, capped at MaxLongPollWait, nil if not sent
 }
 
+// if wait was sent, new log up to MaxInlineLogBytes is returned as
+// data, else as chunks. if neither is set, there was no new log.
 type ExecGetResponse struct {
-	Exit *int   `json:"exit"`
-	Url  string `json:"url"`
+	Exit   *int       `json:"exit"`
+	Signal string     `json:"signal,omitempty"`
+	Reason string     `json:"reason,omitempty"`
+	Chunks []LogChunk `json:"chunks,omitempty"`
+	Data   []byte     `json:"data,omitempty"`
+}
+
+// a presigned url for part of the log. if range is set, it must be
+// sent as the range header.
+type LogChunk struct {
+	Url   string `json:"url"`
+	Range string `json:"range,omitempty"`
+}
+
+// exit is the process exit code, or 128+N if it was killed by signal N
+type ExitStatus struct {
+	Exit   int    `json:"exit"`
+	Signal string `json:"signal,omitempty"`
+	Reason string `json:"reason,omitempty"`
 }
 
 type PushUrls struct {
@@ -39,8 +78,19 @@ type PushUrls struct {
 }
 
 type ExecPostRequest struct {
-	Argv     []string  `json:"argv"`
-	PushUrls *PushUrls `json:"push-urls"`
+	Argv           []string          `json:"argv"`
+	PushUrls       *PushUrls         `json:"push-urls"`
+	Stdin          []byte            `json:"stdin,omitempty"`
+	StdinUpload    string            `json:"stdin-upload,omitempty"`
+	Env            map[string]string `json:"env,omitempty"`
+	Dir            string            `json:"dir,omitempty"` // relative to the workspace if one was uploaded
+	Workspace      string            `json:"workspace,omitempty"`
+	Artifacts      []string          `json:"artifacts,omitempty"` // globs relative to the working directory, collected after exit
+	Raw            bool              `json:"raw,omitempty"`       // copy output bytes unchanged instead of by line
+	Timeout        int               `json:"timeout,omitempty"`   // seconds, capped at MaxTimeout
+	CleanEnv       bool              `json:"clean-env,omitempty"` // omit the lambda environment, including aws credentials
+	Webhook        string            `json:"webhook,omitempty"`   // https url posted to after exit, defaults to the auth's webhook
+	IdempotencyKey string            `json:"-"`                   // sent as the Idempotency-Key header, Submit generates one if empty
 }
 
 type ExecPostResponse struct {
@@ -48,11 +98,26 @@ type ExecPostResponse struct {
 }
 
 type ExecAsyncEvent struct {
-	EventType string    `json:"event-type"`
-	AuthName  string    `json:"auth-name"`
-	Uid       string    `json:"uid"`
-	Argv      []string  `json:"argv"`
-	PushUrls  *PushUrls `json:"push-urls"`
+	EventType   string            `json:"event-type"`
+	AuthName    string            `json:"auth-name"`
+	Uid         string            `json:"uid"`
+	Argv        []string          `json:"argv"`
+	PushUrls    *PushUrls         `json:"push-urls"`
+	Stdin       []byte            `json:"stdin,omitempty"`
+	StdinUpload string            `json:"stdin-upload,omitempty"`
+	Env         map[string]string `json:"env,omitempty"`
+	Dir         string            `json:"dir,omitempty"` // relative to the workspace if one was uploaded
+	Workspace   string            `json:"workspace,omitempty"`
+	Artifacts   []string          `json:"artifacts,omitempty"` // globs relative to the working directory, collected after exit
+	Raw         bool              `json:"raw,omitempty"`       // copy output bytes unchanged instead of by line
+	Timeout     int               `json:"timeout,omitempty"`   // seconds, capped at MaxTimeout
+	CleanEnv    bool              `json:"clean-env,omitempty"` // omit the lambda environment, including aws credentials
+	Webhook     string            `json:"webhook,omitempty"`
+}
+
+type UploadPostResponse struct {
+	Id  string `json:"id"`
+	Url string `json:"url"`
 }
 
 type RecordKey struct {
@@ -94,135 +159,106 @@ func CaseInsensitiveGet(m map[string]string, k string) (string, bool) {
 // if pushUrls are not provided, data will be persisted by aws-rce and
 // this function will poll until process completion, pulling log data
 // as it is available and invoking logDataCallback, then returning the
-// exit code.
+// exit code. stdout and stderr are both passed to logDataCallback, see
+// ExecWith to tell them apart or to set stdin, env, and the rest of
+// ExecPostRequest.
 //
 // if pushUrls are provided, data will be persisted at those urls via
 // http put with content-length set, and this function will exit
 // immediately with exit code -1. urls should remain valid for 20
 // minutes. log will be pushed repeatedly with the entire log
-// contents. exit will be pushed once and will contain the exit
-// code. size will be pushed once, will be pushed last, and will
-// contain the size of the final log push.
-//
+// contents, see DecodeFrames. exit will be pushed once and will
+// contain the json encoded ExitStatus. size will be pushed once, will
+// be pushed last, and will contain the size of the final log push.
 func Exec(ctx context.Context, url, auth string, argv []string, logDataCallback func(logs string), pushUrls *PushUrls) (int, error) {
-	postResponse := ExecPostResponse{}
-	err := lib.RetryAttempts(ctx, 7, func() error {
-		client := http.Client{}
-		data, err := json.Marshal(ExecPostRequest{
-			Argv:     argv,
-			PushUrls: pushUrls,
-		})
-		if err != nil {
-			return err
-		}
-		req, err := http.NewRequest(http.MethodPost, url+"/api/exec", bytes.NewReader(data))
-		req.Header.Set("auth", auth)
-		if err != nil {
-			return err
-		}
-		out, err := client.Do(req)
-		if err != nil {
-			return err
-		}
-		defer func() { _ = out.Body.Close() }()
-		data, err = io.ReadAll(out.Body)
-		if err != nil {
-			return err
-		}
-		if out.StatusCode == 200 {
-			err = json.Unmarshal(data, &postResponse)
-			if err != nil {
-				return err
-			}
-			return nil
-		}
-		if fmt.Sprint(out.StatusCode)[:1] == "5" {
-			return fmt.Errorf("%d %s", out.StatusCode, string(data))
-		}
-		panic(fmt.Sprintf("%d %s", out.StatusCode, string(data)))
+	execReq := &ExecPostRequest{
+		Argv:     argv,
+		PushUrls: pushUrls,
+	}
+	return ExecWith(ctx, url, auth, execReq, func(_ int, data []byte) {
+		logDataCallback(string(data))
 	})
+}
+
+// like Exec, but taking a full ExecPostRequest and invoking
+// logDataCallback with the stream and data of each frame.
+func ExecWith(ctx context.Context, url, auth string, execReq *ExecPostRequest, logDataCallback func(stream int, data []byte)) (int, error) {
+	result, err := NewClient(ClientOptions{Url: url, Auth: auth}).Exec(ctx, execReq, callbackWriter{Stdout, logDataCallback}, callbackWriter{Stderr, logDataCallback})
 	if err != nil {
-		lib.Logger.Println("error:", err)
 		return -1, err
 	}
-	if pushUrls != nil {
-		return -1, nil
+	return result.Exit, nil
+}
+
+// adapts a log data callback to the writers used by Client
+type callbackWriter struct {
+	stream   int
+	callback func(stream int, data []byte)
+}
+
+func (w callbackWriter) Write(data []byte) (int, error) {
+	w.callback(w.stream, data)
+	return len(data), nil
+}
+
+// read stdin to send with a job, failing if it is more than
+// MaxStdinBytes rather than reading without bound
+func ReadStdin(r io.Reader) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(r, MaxStdinBytes+1))
+	if err != nil {
+		return nil, err
 	}
-	rangeStart := 0
-	for {
-		getResp := ExecGetResponse{}
-		err := lib.RetryAttempts(ctx, 7, func() error {
-			client := http.Client{}
-			req, err := http.NewRequest(http.MethodGet, url+fmt.Sprintf("/api/exec?uid=%s&range-start=%d", postResponse.Uid, rangeStart), nil)
-			if err != nil {
-				return err
-			}
-			req.Header.Set("auth", auth)
-			out, err := client.Do(req)
-			if err != nil {
-				return err
-			}
-			defer func() { _ = out.Body.Close() }()
-			data, err := io.ReadAll(out.Body)
-			if err != nil {
-				return err
-			}
-			if out.StatusCode != 200 {
-				return fmt.Errorf("%d %s\n%s", out.StatusCode, out.Request.URL, string(data))
-			}
-			err = json.Unmarshal(data, &getResp)
-			if err != nil {
-				return err
-			}
-			return nil
-		})
-		if err != nil {
-			lib.Logger.Println("error:", err)
-			return -1, err
-		}
-		if getResp.Exit != nil {
-			return *getResp.Exit, nil
-		}
-		var data []byte
-		err = lib.RetryAttempts(ctx, 7, func() error {
-			req, err := http.NewRequest(http.MethodGet, getResp.Url, nil)
-			if err != nil {
-				return err
-			}
-			req.Header.Set("range", fmt.Sprintf("bytes=%d-", rangeStart))
-			out, err := http.DefaultClient.Do(req)
-			if err != nil {
-				return err
-			}
-			data, err = io.ReadAll(out.Body)
-			if err != nil {
-				return err
-			}
-			err = out.Body.Close()
-			if err != nil {
-				return err
-			}
-			switch out.StatusCode {
-			case 200, 206:
-				return nil
-			case 403, 416:
-				time.Sleep(LogShipInterval)
-				data = nil
-				return nil
-			default:
-				data = nil
-				err := fmt.Errorf("http %d", out.StatusCode)
-				lib.Logger.Println("error:", err)
-				return err
-			}
-		})
-		if err != nil {
-			lib.Logger.Println("error:", err)
-			return -1, err
-		}
-		if len(data) > 0 {
-			logDataCallback(string(data))
-			rangeStart += len(data)
-		}
+	if len(data) > MaxStdinBytes {
+		return nil, fmt.Errorf("stdin is more than %d bytes", MaxStdinBytes)
 	}
+	return data, nil
+}
+
+// start a job and return its uid without waiting for it. stdin
+// larger than MaxInlineStdin is uploaded to s3 before submission.
+func Submit(ctx context.Context, url, auth string, execReq *ExecPostRequest) (string, error) {
+	return NewClient(ClientOptions{Url: url, Auth: auth}).Submit(ctx, execReq)
+}
+
+// upload data via a presigned s3 url and return an id that can be
+// referenced by a later ExecPostRequest.
+func Upload(ctx context.Context, url, auth string, r io.ReadSeeker, size int64) (string, error) {
+	return NewFileClient(ClientOptions{Url: url, Auth: auth}).Upload(ctx, r, size)
+}
+
+// request that a job be stopped. the job receives sigterm, then
+// sigkill after CancelGracePeriod. the job still finishes normally
+// from the perspective of Poll, with exit reason cancelled.
+func Cancel(ctx context.Context, url, auth, uid string) error {
+	return NewClient(ClientOptions{Url: url, Auth: auth}).Cancel(ctx, uid)
+}
+
+// poll a job until completion, pulling log data as it is available
+// and invoking logDataCallback with each frame's stream and data, then
+// returning the exit code.
+func Poll(ctx context.Context, url, auth, uid string, logDataCallback func(stream int, data []byte)) (int, error) {
+	return Attach(ctx, url, auth, uid, 0, logDataCallback)
+}
+
+// like Poll, but skipping the first offset bytes of output, counting
+// the data of frames on both streams. a caller that lost its
+// connection can resume with the number of bytes it already received.
+func Attach(ctx context.Context, url, auth, uid string, offset int, logDataCallback func(stream int, data []byte)) (int, error) {
+	result, err := NewClient(ClientOptions{Url: url, Auth: auth}).Attach(ctx, uid, int64(offset), callbackWriter{Stdout, logDataCallback}, callbackWriter{Stderr, logDataCallback})
+	if err != nil {
+		return -1, err
+	}
+	return result.Exit, nil
+}
+
+// read the log of a job as far as it has been written, without
+// waiting for more. the job may still be running.
+func Logs(ctx context.Context, url, auth, uid string, logDataCallback func(stream int, data []byte)) error {
+	return NewClient(ClientOptions{Url: url, Auth: auth}).Logs(ctx, uid, callbackWriter{Stdout, logDataCallback}, callbackWriter{Stderr, logDataCallback})
+}
+
+// block until a job exits and return its exit code, without reading
+// the log.
+func Wait(ctx context.Context, url, auth, uid string) (int, error) {
+	return NewClient(ClientOptions{Url: url, Auth: auth}).Wait(ctx, uid)
 }
@@ -0,0 +1,21 @@
+package rce
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestReadStdin(t *testing.T) {
+	data, err := ReadStdin(bytes.NewReader(make([]byte, MaxStdinBytes)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) != MaxStdinBytes {
+		t.Fatalf("got %d bytes", len(data))
+	}
+	_, err = ReadStdin(bytes.NewReader(make([]byte, MaxStdinBytes+1)))
+	if err == nil || !strings.Contains(err.Error(), "more than") {
+		t.Fatalf("expected error for stdin over the limit, got: %v", err)
+	}
+}
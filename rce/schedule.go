@@ -0,0 +1,296 @@
+package rce
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nathants/libaws/lib"
+)
+
+// the scheduled lambda event fires every 5 minutes and dispatches due
+// schedules, so a schedule runs at most once per tick and up to 5
+// minutes after its cron time.
+const (
+	ScheduleTick      = 5 * time.Minute
+	SchedulesIndex    = "schedules"
+	ScheduleShard     = "0" // every schedule record is in one partition of the schedules index
+	MaxSchedules      = 100 // per auth
+	ScheduleRunsLimit = 20  // recent runs returned with a schedule
+)
+
+// the job run by a schedule. stdin and uploads are not supported, since
+// uploads expire after a day.
+type SchedulePostRequest struct {
+	Name     string            `json:"name"`
+	Cron     string            `json:"cron"` // minute hour day-of-month month day-of-week, in utc
+	Argv     []string          `json:"argv"`
+	Env      map[string]string `json:"env,omitempty"`
+	Dir      string            `json:"dir,omitempty"`
+	CleanEnv bool              `json:"clean-env,omitempty"`
+	Timeout  int               `json:"timeout,omitempty"`
+	Webhook  string            `json:"webhook,omitempty"`
+}
+
+func (r *SchedulePostRequest) Validate() error {
+	if r.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	cron, err := ParseCron(r.Cron)
+	if err != nil {
+		return err
+	}
+	if cron.Next(time.Now()).IsZero() {
+		return fmt.Errorf("cron never matches: %q", r.Cron)
+	}
+	return r.ExecRequest().Validate()
+}
+
+func (r *SchedulePostRequest) ExecRequest() *ExecPostRequest {
+	return &ExecPostRequest{
+		Argv:     r.Argv,
+		Env:      r.Env,
+		Dir:      r.Dir,
+		CleanEnv: r.CleanEnv,
+		Timeout:  r.Timeout,
+		Webhook:  r.Webhook,
+	}
+}
+
+// stored in dynamodb as schedule.<id>. next is unix millis, and is the
+// range key of the schedules index so the tick can query for due
+// schedules. auth-id is the id of the auth record, and runs stop once
+// it is removed.
+type ScheduleRecordData struct {
+	SchedulePostRequest
+	AuthName  string `json:"auth-name"`
+	AuthId    string `json:"auth-id"`
+	Shard     string `json:"schedule-shard"`
+	Created   int64  `json:"created"`
+	Next      int64  `json:"next"`
+	LastRun   string `json:"last-run,omitempty"` // uid of the last job
+	LastRunAt int64  `json:"last-run-at,omitempty"`
+}
+
+type ScheduleRecord struct {
+	RecordKey
+	ScheduleRecordData
+}
+
+func ScheduleRecordID(id string) string {
+	return fmt.Sprintf("schedule.%s", id)
+}
+
+// stored in dynamodb as schedule-count.<auth-name> with a count
+// attribute, updated in the same transaction that puts or deletes a
+// schedule, so concurrent posts cannot exceed MaxSchedules.
+func ScheduleCountRecordID(authName string) string {
+	return fmt.Sprintf("schedule-count.%s", authName)
+}
+
+type Schedule struct {
+	Id        string            `json:"id"`
+	Name      string            `json:"name"`
+	Cron      string            `json:"cron"`
+	Argv      []string          `json:"argv"`
+	Env       map[string]string `json:"env,omitempty"`
+	Dir       string            `json:"dir,omitempty"`
+	CleanEnv  bool              `json:"clean-env,omitempty"`
+	Timeout   int               `json:"timeout,omitempty"`
+	Created   time.Time         `json:"created"`
+	Next      time.Time         `json:"next"`
+	LastRun   string            `json:"last-run,omitempty"`
+	LastRunAt *time.Time        `json:"last-run-at,omitempty"`
+}
+
+func (r *ScheduleRecord) Schedule() *Schedule {
+	schedule := &Schedule{
+		Id:       strings.TrimPrefix(r.ID, "schedule."),
+		Name:     r.Name,
+		Cron:     r.Cron,
+		Argv:     r.Argv,
+		Env:      r.Env,
+		Dir:      r.Dir,
+		CleanEnv: r.CleanEnv,
+		Timeout:  r.Timeout,
+		Created:  lib.FromUnixMilli(r.Created).UTC(),
+		Next:     lib.FromUnixMilli(r.Next).UTC(),
+		LastRun:  r.LastRun,
+	}
+	if r.LastRunAt != 0 {
+		lastRunAt := lib.FromUnixMilli(r.LastRunAt).UTC()
+		schedule.LastRunAt = &lastRunAt
+	}
+	return schedule
+}
+
+type SchedulesGetResponse struct {
+	Schedules []Schedule `json:"schedules"`
+}
+
+// runs are the most recent jobs of the schedule, newest first
+type ScheduleGetResponse struct {
+	Schedule Schedule    `json:"schedule"`
+	Runs     []JobStatus `json:"runs"`
+}
+
+func ValidateScheduleId(id string) error {
+	if !uuidPattern.MatchString(id) {
+		return fmt.Errorf("bad schedule id: %q", id)
+	}
+	return nil
+}
+
+// a standard 5 field cron expression. each field is *, a number, a
+// range like 1-5, a step like */15 or 0-30/10, or a comma separated
+// list of those. day of week is 0-6 from sunday, and 7 is also sunday.
+// like cron, when both day fields are restricted a day matches either,
+// and a day field starting with *, like */2, is not restricted.
+// @hourly, @daily, @midnight, @weekly, and @monthly are also accepted.
+type Cron struct {
+	minute  []bool
+	hour    []bool
+	dom     []bool
+	month   []bool
+	dow     []bool
+	domStar bool
+	dowStar bool
+}
+
+var cronMacros = map[string]string{
+	"@hourly":   "0 * * * *",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@weekly":   "0 0 * * 0",
+	"@monthly":  "0 0 1 * *",
+}
+
+func ParseCron(expr string) (*Cron, error) {
+	expr = strings.TrimSpace(expr)
+	if macro, ok := cronMacros[expr]; ok {
+		expr = macro
+	}
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("bad cron, expected 5 fields: %q", expr)
+	}
+	c := &Cron{
+		domStar: strings.HasPrefix(fields[2], "*"),
+		dowStar: strings.HasPrefix(fields[4], "*"),
+	}
+	var err error
+	bounds := []struct {
+		name     string
+		min, max int
+		set      *[]bool
+	}{
+		{"minute", 0, 59, &c.minute},
+		{"hour", 0, 23, &c.hour},
+		{"day of month", 1, 31, &c.dom},
+		{"month", 1, 12, &c.month},
+		{"day of week", 0, 7, &c.dow},
+	}
+	for i, b := range bounds {
+		*b.set, err = parseCronField(fields[i], b.min, b.max)
+		if err != nil {
+			return nil, fmt.Errorf("bad cron %s: %w", b.name, err)
+		}
+	}
+	if c.dow[7] {
+		c.dow[0] = true
+	}
+	return c, nil
+}
+
+func parseCronField(field string, min, max int) ([]bool, error) {
+	set := make([]bool, max+1)
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if i := strings.Index(part, "/"); i != -1 {
+			var err error
+			step, err = strconv.Atoi(part[i+1:])
+			if err != nil || step < 1 {
+				return nil, fmt.Errorf("bad step: %q", part)
+			}
+			part = part[:i]
+		}
+		start, end := min, max
+		switch {
+		case part == "*":
+		case strings.Contains(part, "-"):
+			bounds := strings.SplitN(part, "-", 2)
+			var err error
+			start, err = strconv.Atoi(bounds[0])
+			if err != nil {
+				return nil, fmt.Errorf("bad range: %q", part)
+			}
+			end, err = strconv.Atoi(bounds[1])
+			if err != nil {
+				return nil, fmt.Errorf("bad range: %q", part)
+			}
+		default:
+			var err error
+			start, err = strconv.Atoi(part)
+			if err != nil {
+				return nil, fmt.Errorf("bad value: %q", part)
+			}
+			end = start
+			if step != 1 {
+				end = max
+			}
+		}
+		if start < min || end > max || start > end {
+			return nil, fmt.Errorf("out of range %d-%d: %q", min, max, field)
+		}
+		for v := start; v <= end; v += step {
+			set[v] = true
+		}
+	}
+	return set, nil
+}
+
+func (c *Cron) matchDay(t time.Time) bool {
+	dom := c.dom[t.Day()]
+	dow := c.dow[int(t.Weekday())]
+	if c.domStar || c.dowStar {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+// the first minute after t that matches, in utc. the zero time if none
+// does within 5 years, like 0 0 30 2 *.
+func (c *Cron) Next(t time.Time) time.Time {
+	t = t.UTC().Truncate(time.Minute).Add(time.Minute)
+	end := t.AddDate(5, 0, 0)
+	for t.Before(end) {
+		if !c.month[int(t.Month())] {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+			continue
+		}
+		if !c.matchDay(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, time.UTC)
+			continue
+		}
+		if !c.hour[t.Hour()] {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, time.UTC)
+			continue
+		}
+		if !c.minute[t.Minute()] {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+func AddSchedule(ctx context.Context, url, auth string, scheduleReq *SchedulePostRequest) (*Schedule, error) {
+	return NewScheduleClient(ClientOptions{Url: url, Auth: auth}).AddSchedule(ctx, scheduleReq)
+}
+
+func Schedules(ctx context.Context, url, auth string) ([]Schedule, error) {
+	return NewScheduleClient(ClientOptions{Url: url, Auth: auth}).Schedules(ctx)
+}
@@ -0,0 +1,86 @@
+package rce
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseCronErrors(t *testing.T) {
+	tests := []struct {
+		expr string
+		err  string
+	}{
+		{"", "expected 5 fields"},
+		{"* * * *", "expected 5 fields"},
+		{"* * * * * *", "expected 5 fields"},
+		{"@yearly", "expected 5 fields"},
+		{"60 * * * *", "minute: out of range"},
+		{"* 24 * * *", "hour: out of range"},
+		{"* * 0 * *", "day of month: out of range"},
+		{"* * 32 * *", "day of month: out of range"},
+		{"* * * 13 *", "month: out of range"},
+		{"* * * * 8", "day of week: out of range"},
+		{"5-1 * * * *", "out of range"},
+		{"*/0 * * * *", "bad step"},
+		{"*/x * * * *", "bad step"},
+		{"a * * * *", "bad value"},
+		{"1-a * * * *", "bad range"},
+		{"1,,2 * * * *", "bad value"},
+	}
+	for _, test := range tests {
+		t.Run(test.expr, func(t *testing.T) {
+			_, err := ParseCron(test.expr)
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Fatalf("expected error containing %q, got: %v", test.err, err)
+			}
+		})
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	monday := time.Date(2024, 1, 1, 10, 30, 0, 0, time.UTC)
+	tests := []struct {
+		expr string
+		from time.Time
+		want time.Time
+	}{
+		{"* * * * *", monday, time.Date(2024, 1, 1, 10, 31, 0, 0, time.UTC)},
+		{"* * * * *", monday.Add(30 * time.Second), time.Date(2024, 1, 1, 10, 31, 0, 0, time.UTC)},
+		{"30 10 * * *", monday, time.Date(2024, 1, 2, 10, 30, 0, 0, time.UTC)},
+		{"0 * * * *", monday, time.Date(2024, 1, 1, 11, 0, 0, 0, time.UTC)},
+		{"*/15 * * * *", monday, time.Date(2024, 1, 1, 10, 45, 0, 0, time.UTC)},
+		{"0-30/10 * * * *", monday, time.Date(2024, 1, 1, 11, 0, 0, 0, time.UTC)},
+		{"5,35 * * * *", monday, time.Date(2024, 1, 1, 10, 35, 0, 0, time.UTC)},
+		{"0 9 * * 1-5", monday, time.Date(2024, 1, 2, 9, 0, 0, 0, time.UTC)},
+		{"0 0 * * 0", monday, time.Date(2024, 1, 7, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * * 7", monday, time.Date(2024, 1, 7, 0, 0, 0, 0, time.UTC)},
+		{"0 0 13 * 5", monday, time.Date(2024, 1, 5, 0, 0, 0, 0, time.UTC)},
+		{"0 0 3 * 5", monday, time.Date(2024, 1, 3, 0, 0, 0, 0, time.UTC)},
+		{"0 0 */2 * 1", monday, time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)},
+		{"0 0 1 * */2", monday, time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 1-31 * 1", monday, time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)},
+		{"0 0 31 * *", time.Date(2024, 1, 31, 10, 30, 0, 0, time.UTC), time.Date(2024, 3, 31, 0, 0, 0, 0, time.UTC)},
+		{"0 0 1 1 *", time.Date(2024, 12, 31, 23, 59, 30, 0, time.UTC), time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"0 0 30 2 *", monday, time.Time{}},
+		{"@hourly", monday, time.Date(2024, 1, 1, 11, 0, 0, 0, time.UTC)},
+		{"@daily", monday, time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)},
+		{"@midnight", monday, time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)},
+		{"@weekly", monday, time.Date(2024, 1, 7, 0, 0, 0, 0, time.UTC)},
+		{"@monthly", monday, time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 9 * * *", monday.In(time.FixedZone("est", -5*3600)), time.Date(2024, 1, 2, 9, 0, 0, 0, time.UTC)},
+	}
+	for _, test := range tests {
+		t.Run(test.expr, func(t *testing.T) {
+			cron, err := ParseCron(test.expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := cron.Next(test.from)
+			if !got.Equal(test.want) {
+				t.Fatalf("next %s after %s: got %s, want %s", test.expr, test.from, got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,119 @@
+package rce
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// GET /api/exec/stream returns server-sent events. the api cannot hold
+// a response open, so each response covers up to MaxLongPollWait
+// seconds or MaxStreamBytes of log and ends, and the caller reconnects
+// with the Last-Event-ID header, see StreamEventId. the exit event is
+// last, and is returned again on reconnect.
+const (
+	StreamEventState = "state"     // data is JobStatus, sent on connect and on each change
+	StreamEventLog   = "log"       // data is StreamLog, a frame or part of a large one
+	StreamEventExit  = "exit"      // data is ExitStatus
+	StreamRetry      = 1000        // milliseconds an EventSource waits before reconnecting
+	MaxStreamBytes   = 1024 * 1024 // max size of a response body, larger frames are split across log events
+)
+
+// data is base64 in json, so output that is not valid utf-8, or a
+// character split across frames, is passed through unchanged.
+type StreamLog struct {
+	Stream int    `json:"stream"`
+	Data   []byte `json:"data"`
+}
+
+// the id of a stream event is the byte offset of a frame in the log,
+// followed by +<n> if the first n bytes of that frame's data were
+// already sent, since a large frame is split across events.
+func StreamEventId(offset, sent int) string {
+	if sent == 0 {
+		return fmt.Sprint(offset)
+	}
+	return fmt.Sprintf("%d+%d", offset, sent)
+}
+
+func ParseStreamEventId(id string) (int, int, error) {
+	parts := strings.SplitN(id, "+", 2)
+	offset, err := strconv.Atoi(parts[0])
+	if err != nil || offset < 0 {
+		return 0, 0, fmt.Errorf("bad event id: %q", id)
+	}
+	sent := 0
+	if len(parts) == 2 {
+		sent, err = strconv.Atoi(parts[1])
+		if err != nil || sent < 1 {
+			return 0, 0, fmt.Errorf("bad event id: %q", id)
+		}
+	}
+	return offset, sent, nil
+}
+
+type StreamEvent struct {
+	Id    string
+	Event string
+	Data  []byte // a single line, like json
+}
+
+func EncodeStreamEvent(w io.Writer, event StreamEvent) error {
+	var buf bytes.Buffer
+	if event.Id != "" {
+		_, _ = fmt.Fprintf(&buf, "id: %s\n", event.Id)
+	}
+	if event.Event != "" {
+		_, _ = fmt.Fprintf(&buf, "event: %s\n", event.Event)
+	}
+	_, _ = fmt.Fprintf(&buf, "data: %s\n\n", event.Data)
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// parse server-sent events from r, invoking callback with each. unlike
+// EventSource, an event without an id field has an empty id, so the
+// caller can tell where a batch of log events ends.
+func DecodeStreamEvents(r io.Reader, callback func(event StreamEvent) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), MaxStreamBytes*8)
+	event := StreamEvent{}
+	var data [][]byte
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			if data != nil {
+				event.Data = bytes.Join(data, []byte("\n"))
+				err := callback(event)
+				if err != nil {
+					return err
+				}
+			}
+			event = StreamEvent{}
+			data = nil
+			continue
+		}
+		if strings.HasPrefix(line, ":") {
+			continue
+		}
+		parts := strings.SplitN(line, ":", 2)
+		field := parts[0]
+		value := ""
+		if len(parts) == 2 {
+			value = strings.TrimPrefix(parts[1], " ")
+		}
+		switch field {
+		case "id":
+			event.Id = value
+		case "event":
+			event.Event = value
+		case "data":
+			data = append(data, []byte(value))
+		default:
+		}
+	}
+	return scanner.Err()
+}
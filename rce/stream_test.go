@@ -0,0 +1,64 @@
+package rce
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func TestStreamEventId(t *testing.T) {
+	tests := []struct {
+		id     string
+		offset int
+		sent   int
+		err    bool
+	}{
+		{"0", 0, 0, false},
+		{"123", 123, 0, false},
+		{"123+45", 123, 45, false},
+		{"", 0, 0, true},
+		{"-1", 0, 0, true},
+		{"x", 0, 0, true},
+		{"1+", 0, 0, true},
+		{"1+0", 0, 0, true},
+		{"1+x", 0, 0, true},
+	}
+	for _, test := range tests {
+		offset, sent, err := ParseStreamEventId(test.id)
+		if (err != nil) != test.err {
+			t.Fatalf("%q: err: %v", test.id, err)
+		}
+		if err != nil {
+			continue
+		}
+		if offset != test.offset || sent != test.sent {
+			t.Fatalf("%q: got %d %d", test.id, offset, sent)
+		}
+		if StreamEventId(offset, sent) != test.id {
+			t.Fatalf("%q: round trip got %q", test.id, StreamEventId(offset, sent))
+		}
+	}
+}
+
+func TestStreamLogBytes(t *testing.T) {
+	data := []byte{'a', 0xe2, 0x82} // the start of a multibyte character
+	encoded, err := json.Marshal(StreamLog{Stream: Stdout, Data: data})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	err = EncodeStreamEvent(&buf, StreamEvent{Id: "1", Event: StreamEventLog, Data: encoded})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded StreamLog
+	err = DecodeStreamEvents(&buf, func(event StreamEvent) error {
+		return json.Unmarshal(event.Data, &decoded)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(decoded.Data, data) {
+		t.Fatalf("got %q", decoded.Data)
+	}
+}
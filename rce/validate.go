@@ -0,0 +1,117 @@
+package rce
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	MaxExecPostBytes = 1024 * 200 // the post becomes an async lambda payload, which is limited to 256KB
+	MaxArtifactGlobs = 64
+)
+
+var (
+	uuidPattern = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$`)
+	uidPattern  = regexp.MustCompile(`^[0-9]+\.[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$`)
+)
+
+// uids are "<unix-seconds>.<uuid>"
+func ValidateUid(uid string) error {
+	if !uidPattern.MatchString(uid) {
+		return fmt.Errorf("bad uid: %q", uid)
+	}
+	return nil
+}
+
+// upload ids are uuids
+func ValidateUploadId(id string) error {
+	if !uuidPattern.MatchString(id) {
+		return fmt.Errorf("bad upload id: %q", id)
+	}
+	return nil
+}
+
+func (r *ExecPostRequest) Validate() error {
+	if len(r.Argv) == 0 || r.Argv[0] == "" {
+		return fmt.Errorf("argv must not be empty")
+	}
+	if len(r.Stdin) > MaxInlineStdin {
+		return fmt.Errorf("stdin is %d bytes, more than %d, upload it instead", len(r.Stdin), MaxInlineStdin)
+	}
+	if r.Stdin != nil && r.StdinUpload != "" {
+		return fmt.Errorf("stdin and stdin-upload are exclusive")
+	}
+	if r.StdinUpload != "" {
+		err := ValidateUploadId(r.StdinUpload)
+		if err != nil {
+			return err
+		}
+	}
+	if r.Workspace != "" {
+		err := ValidateUploadId(r.Workspace)
+		if err != nil {
+			return err
+		}
+	}
+	for k := range r.Env {
+		if k == "" || strings.ContainsAny(k, "=\x00") {
+			return fmt.Errorf("bad env key: %q", k)
+		}
+	}
+	if len(r.Artifacts) > MaxArtifactGlobs {
+		return fmt.Errorf("more than %d artifact globs", MaxArtifactGlobs)
+	}
+	for _, glob := range r.Artifacts {
+		if glob == "" {
+			return fmt.Errorf("artifact glob must not be empty")
+		}
+	}
+	if r.Timeout < 0 {
+		return fmt.Errorf("bad timeout: %d", r.Timeout)
+	}
+	if r.Webhook != "" {
+		err := ValidateWebhook(r.Webhook)
+		if err != nil {
+			return err
+		}
+	}
+	if r.PushUrls != nil {
+		for name, url := range map[string]string{"log": r.PushUrls.Log, "size": r.PushUrls.Size, "exit": r.PushUrls.Exit} {
+			if !strings.HasPrefix(url, "https://") {
+				return fmt.Errorf("push url %s must be https", name)
+			}
+		}
+	}
+	return nil
+}
+
+// parse the query string of GET /api/exec. range-start defaults to 0.
+func ParseExecGetRequest(params map[string]string) (ExecGetRequest, error) {
+	r := ExecGetRequest{
+		Uid: params["uid"],
+	}
+	err := ValidateUid(r.Uid)
+	if err != nil {
+		return r, err
+	}
+	if params["range-start"] != "" {
+		r.RangeStart, err = strconv.Atoi(params["range-start"])
+		if err != nil || r.RangeStart < 0 {
+			return r, fmt.Errorf("bad range-start: %s", params["range-start"])
+		}
+	}
+	wait, ok := params["wait"]
+	if ok {
+		seconds, err := strconv.Atoi(wait)
+		if err != nil || seconds < 0 {
+			return r, fmt.Errorf("bad wait: %s", wait)
+		}
+		if seconds > MaxLongPollWait {
+			seconds = MaxLongPollWait
+		}
+		r.Wait = &seconds
+	}
+	return r, nil
+}
@@ -0,0 +1,202 @@
+package rce
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	neturl "net/url"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// after a job exits, its webhook gets a post of WebhookPayload, from the
+// job's webhook field or else the default webhook of its auth. the body
+// is signed with the secret of its auth, from webhook-get, see
+// VerifyWebhook. posts are sent by a separate async invocation of the
+// lambda, so slow receivers do not hold up the job or the lost job sweep.
+const (
+	WebhookIdHeader        = "Rce-Webhook-Id" // the uid, the same across attempts
+	WebhookTimestampHeader = "Rce-Webhook-Timestamp"
+	WebhookSignatureHeader = "Rce-Webhook-Signature"
+	WebhookAttempts        = 4
+	WebhookAttemptTimeout  = 5 * time.Second
+	WebhookTolerance       = 5 * time.Minute // max age of a timestamp accepted by VerifyWebhook
+)
+
+var ErrBadWebhookSignature = errors.New("bad webhook signature")
+
+// log-url identifies the server-sent events log of the job for a
+// client that has its auth. it needs the auth header, so it is not a
+// link a receiver can fetch.
+type WebhookPayload struct {
+	Uid      string   `json:"uid"`
+	AuthName string   `json:"auth-name"`
+	Argv     []string `json:"argv"`
+	State    string   `json:"state"`
+	Exit     int      `json:"exit"`
+	Signal   string   `json:"signal,omitempty"`
+	Reason   string   `json:"reason,omitempty"`
+	Duration float64  `json:"duration"` // seconds
+	LogSize  int      `json:"log-size"`
+	LogUrl   string   `json:"log-url"`
+	Group    string   `json:"group,omitempty"`
+	Schedule string   `json:"schedule,omitempty"`
+}
+
+// one post to a webhook, stored on the job record in order. status is
+// zero if no response was received.
+type WebhookDelivery struct {
+	Attempt  int       `json:"attempt"`
+	Time     time.Time `json:"time"`
+	Status   int       `json:"status,omitempty"`
+	Error    string    `json:"error,omitempty"`
+	Duration float64   `json:"duration"` // seconds
+}
+
+type WebhookAsyncEvent struct {
+	EventType string `json:"event-type"`
+	Uid       string `json:"uid"`
+}
+
+// stored in dynamodb as webhook.<auth-name>. value is the default
+// webhook url, and secret signs the posts of every job of the auth. the
+// secret is created on first use, and kept when the url is removed.
+type WebhookRecordData struct {
+	Value  string `json:"value,omitempty"`
+	Secret string `json:"secret"`
+}
+
+type WebhookRecord struct {
+	RecordKey
+	WebhookRecordData
+}
+
+func WebhookRecordID(authName string) string {
+	return fmt.Sprintf("webhook.%s", authName)
+}
+
+type WebhookPutRequest struct {
+	Url string `json:"url"`
+}
+
+// returned by both get and put
+type WebhookGetResponse struct {
+	Url    string `json:"url"`
+	Secret string `json:"secret"`
+}
+
+func ValidateWebhook(url string) error {
+	if !strings.HasPrefix(url, "https://") || len(url) == len("https://") {
+		return fmt.Errorf("webhook must be an https url: %q", url)
+	}
+	return nil
+}
+
+// addresses that are not public even though the ip methods of net
+// allow them
+var internalNets = func() []*net.IPNet {
+	var nets []*net.IPNet
+	for _, cidr := range []string{
+		"0.0.0.0/8",     // this network
+		"100.64.0.0/10", // carrier grade nat
+		"192.0.0.0/24",  // ietf protocol assignments
+		"198.18.0.0/15", // benchmarking
+		"240.0.0.0/4",   // reserved
+		"64:ff9b::/96",  // nat64, can map to any ipv4 address
+	} {
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		nets = append(nets, n)
+	}
+	return nets
+}()
+
+// whether ip is a public unicast address, so not loopback, private,
+// link-local, like the instance metadata service at 169.254.169.254,
+// or otherwise internal
+func PublicIP(ip net.IP) bool {
+	if ip == nil ||
+		ip.IsLoopback() ||
+		ip.IsPrivate() ||
+		ip.IsLinkLocalUnicast() ||
+		ip.IsUnspecified() ||
+		ip.IsMulticast() {
+		return false
+	}
+	for _, n := range internalNets {
+		if n.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// resolve the host of a webhook and check every address is public, so
+// a webhook cannot reach the network of the lambda
+func CheckWebhookHost(ctx context.Context, url string) error {
+	u, err := neturl.Parse(url)
+	if err != nil {
+		return fmt.Errorf("bad webhook: %w", err)
+	}
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, u.Hostname())
+	if err != nil {
+		return fmt.Errorf("webhook host does not resolve: %s", u.Hostname())
+	}
+	for _, addr := range addrs {
+		if !PublicIP(addr.IP) {
+			return fmt.Errorf("webhook host is not public: %s is %s", u.Hostname(), addr.IP)
+		}
+	}
+	return nil
+}
+
+// a net.Dialer control func for webhook posts. it checks the address
+// actually connected to, so dns that changes after CheckWebhookHost, or
+// a redirect, cannot reach an internal address.
+func WebhookDialControl(_, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if !PublicIP(ip) {
+		return fmt.Errorf("webhook address is not public: %s", host)
+	}
+	return nil
+}
+
+// the signature is v1= followed by the hex hmac-sha256 of the timestamp,
+// a period, and the body
+func SignWebhook(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	_, _ = fmt.Fprintf(mac, "%d.", timestamp)
+	_, _ = mac.Write(body)
+	return "v1=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// for receivers, check the signature and that the timestamp is within
+// WebhookTolerance of now, so a captured request cannot be replayed later
+func VerifyWebhook(secret string, header http.Header, body []byte) error {
+	timestamp, err := strconv.ParseInt(header.Get(WebhookTimestampHeader), 10, 64)
+	if err != nil {
+		return fmt.Errorf("%w: bad timestamp", ErrBadWebhookSignature)
+	}
+	age := time.Since(time.Unix(timestamp, 0))
+	if age > WebhookTolerance || age < -WebhookTolerance {
+		return fmt.Errorf("%w: timestamp is %s old", ErrBadWebhookSignature, age.Round(time.Second))
+	}
+	expected := SignWebhook(secret, timestamp, body)
+	if !hmac.Equal([]byte(expected), []byte(header.Get(WebhookSignatureHeader))) {
+		return ErrBadWebhookSignature
+	}
+	return nil
+}
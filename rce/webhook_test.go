@@ -0,0 +1,123 @@
+package rce
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestVerifyWebhook(t *testing.T) {
+	secret := "secret"
+	body := []byte(`{"uid":"1.abc","exit":0}`)
+	now := time.Now().Unix()
+	header := func(timestamp string, signature string) http.Header {
+		h := http.Header{}
+		h.Set(WebhookTimestampHeader, timestamp)
+		h.Set(WebhookSignatureHeader, signature)
+		return h
+	}
+	tests := []struct {
+		name   string
+		secret string
+		header http.Header
+		body   []byte
+		ok     bool
+	}{
+		{"valid", secret, header(fmt.Sprint(now), SignWebhook(secret, now, body)), body, true},
+		{"valid within tolerance", secret, header(fmt.Sprint(now-240), SignWebhook(secret, now-240, body)), body, true},
+		{"wrong secret", "other", header(fmt.Sprint(now), SignWebhook(secret, now, body)), body, false},
+		{"modified body", secret, header(fmt.Sprint(now), SignWebhook(secret, now, body)), []byte(`{"uid":"1.abc","exit":1}`), false},
+		{"timestamp not signed", secret, header(fmt.Sprint(now-1), SignWebhook(secret, now, body)), body, false},
+		{"old timestamp", secret, header(fmt.Sprint(now-600), SignWebhook(secret, now-600, body)), body, false},
+		{"future timestamp", secret, header(fmt.Sprint(now+600), SignWebhook(secret, now+600, body)), body, false},
+		{"missing timestamp", secret, header("", SignWebhook(secret, now, body)), body, false},
+		{"bad timestamp", secret, header("abc", SignWebhook(secret, now, body)), body, false},
+		{"missing signature", secret, header(fmt.Sprint(now), ""), body, false},
+		{"unversioned signature", secret, header(fmt.Sprint(now), SignWebhook(secret, now, body)[len("v1="):]), body, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := VerifyWebhook(test.secret, test.header, test.body)
+			if test.ok && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !test.ok && !errors.Is(err, ErrBadWebhookSignature) {
+				t.Fatalf("expected ErrBadWebhookSignature, got: %v", err)
+			}
+		})
+	}
+}
+
+func TestSignWebhook(t *testing.T) {
+	// hmac-sha256 of "1700000000.{}" keyed by "secret"
+	want := "v1=b8569b78799ff9e3cbff0fc2d63a33a2b57f3282abd07c37ae5e8e7d79a5f163"
+	got := SignWebhook("secret", 1700000000, []byte("{}"))
+	if got != want {
+		t.Fatalf("got %s, want %s", got, want)
+	}
+}
+
+func TestPublicIP(t *testing.T) {
+	tests := []struct {
+		ip     string
+		public bool
+	}{
+		{"8.8.8.8", true},
+		{"52.94.236.248", true},
+		{"2606:4700:4700::1111", true},
+		{"127.0.0.1", false},
+		{"10.1.2.3", false},
+		{"172.16.0.1", false},
+		{"192.168.1.1", false},
+		{"169.254.169.254", false},
+		{"100.64.0.1", false},
+		{"0.0.0.0", false},
+		{"224.0.0.1", false},
+		{"::1", false},
+		{"fe80::1", false},
+		{"fd00:ec2::254", false},
+		{"::ffff:169.254.169.254", false},
+		{"64:ff9b::a9fe:a9fe", false},
+	}
+	for _, test := range tests {
+		t.Run(test.ip, func(t *testing.T) {
+			if PublicIP(net.ParseIP(test.ip)) != test.public {
+				t.Fatalf("expected public %v", test.public)
+			}
+		})
+	}
+}
+
+func TestCheckWebhookHost(t *testing.T) {
+	for _, url := range []string{
+		"https://127.0.0.1/hook",
+		"https://169.254.169.254/latest/meta-data/",
+		"https://[::1]:8443/hook",
+		"https://10.0.0.1/hook",
+	} {
+		err := CheckWebhookHost(context.Background(), url)
+		if err == nil {
+			t.Fatalf("expected %s to be rejected", url)
+		}
+	}
+	err := CheckWebhookHost(context.Background(), "https://8.8.8.8/hook")
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWebhookDialControl(t *testing.T) {
+	if WebhookDialControl("tcp", "169.254.169.254:80", nil) == nil {
+		t.Fatal("expected link-local address to be rejected")
+	}
+	if WebhookDialControl("tcp6", "[::1]:443", nil) == nil {
+		t.Fatal("expected loopback address to be rejected")
+	}
+	if err := WebhookDialControl("tcp", "8.8.8.8:443", nil); err != nil {
+		t.Fatal(err)
+	}
+}
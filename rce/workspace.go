@@ -0,0 +1,259 @@
+package rce
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// lambda has 512MB of ephemeral storage by default, leave room for
+// logs and whatever the job writes.
+const MaxWorkspaceBytes = 1024 * 1024 * 256
+
+const IgnoreFile = ".rceignore"
+
+type ignoreRule struct {
+	pattern  string
+	negate   bool
+	dirOnly  bool
+	anchored bool
+}
+
+// read gitignore style rules. patterns without a slash match the
+// basename at any depth, patterns with a slash match the path relative
+// to the workspace root, a trailing slash matches only directories,
+// and a leading ! re-includes a previously ignored path.
+func readIgnoreRules(dir string) ([]ignoreRule, error) {
+	data, err := os.ReadFile(filepath.Join(dir, IgnoreFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var rules []ignoreRule
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		rule := ignoreRule{}
+		if strings.HasPrefix(line, "!") {
+			rule.negate = true
+			line = line[1:]
+		}
+		if strings.HasSuffix(line, "/") {
+			rule.dirOnly = true
+			line = strings.TrimRight(line, "/")
+		}
+		if strings.Contains(line, "/") {
+			rule.anchored = true
+			line = strings.TrimLeft(line, "/")
+		}
+		_, err := filepath.Match(line, "")
+		if err != nil {
+			return nil, fmt.Errorf("%s: bad pattern: %s", IgnoreFile, line)
+		}
+		rule.pattern = line
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+func ignored(rules []ignoreRule, rel string, isDir bool) bool {
+	result := false
+	for _, rule := range rules {
+		if rule.dirOnly && !isDir {
+			continue
+		}
+		name := filepath.Base(rel)
+		if rule.anchored {
+			name = rel
+		}
+		match, _ := filepath.Match(rule.pattern, name)
+		if match {
+			result = !rule.negate
+		}
+	}
+	return result
+}
+
+// write dir as a gzipped tarball to w, skipping paths matched by
+// .rceignore, and failing if the total size exceeds MaxWorkspaceBytes.
+func TarWorkspace(dir string, w io.Writer) error {
+	rules, err := readIgnoreRules(dir)
+	if err != nil {
+		return err
+	}
+	gzw := gzip.NewWriter(w)
+	tw := tar.NewWriter(gzw)
+	total := int64(0)
+	err = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		if rel == "." {
+			return nil
+		}
+		rel = filepath.ToSlash(rel)
+		if ignored(rules, rel, info.IsDir()) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		link := ""
+		if info.Mode()&os.ModeSymlink != 0 {
+			link, err = os.Readlink(path)
+			if err != nil {
+				return err
+			}
+		} else if !info.IsDir() && !info.Mode().IsRegular() {
+			return nil // skip sockets, devices, and pipes
+		}
+		header, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+		header.Name = rel
+		err = tw.WriteHeader(header)
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		total += info.Size()
+		if total > MaxWorkspaceBytes {
+			return fmt.Errorf("workspace exceeds %d bytes, add paths to %s", MaxWorkspaceBytes, IgnoreFile)
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = f.Close() }()
+		_, err = io.CopyN(tw, f, info.Size())
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	err = tw.Close()
+	if err != nil {
+		return err
+	}
+	return gzw.Close()
+}
+
+// extract a gzipped tarball from r into dir, rejecting paths that
+// escape dir and failing if the total size exceeds MaxWorkspaceBytes.
+// symlinks must be relative and point inside dir, and no entry is
+// written through a symlink from an earlier entry.
+func UntarWorkspace(r io.Reader, dir string) error {
+	gzr, err := gzip.NewReader(r)
+	if err != nil {
+		return err
+	}
+	tr := tar.NewReader(gzr)
+	total := int64(0)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		name := filepath.Clean(filepath.FromSlash(header.Name))
+		if filepath.IsAbs(name) || name == ".." || strings.HasPrefix(name, ".."+string(filepath.Separator)) {
+			return fmt.Errorf("workspace path escapes root: %s", header.Name)
+		}
+		err = checkNoSymlinks(dir, name)
+		if err != nil {
+			return err
+		}
+		path := filepath.Join(dir, name)
+		switch header.Typeflag {
+		case tar.TypeDir:
+			err := os.MkdirAll(path, 0755)
+			if err != nil {
+				return err
+			}
+		case tar.TypeSymlink:
+			link := filepath.FromSlash(header.Linkname)
+			target := filepath.Join(filepath.Dir(name), link)
+			if filepath.IsAbs(link) || target == ".." || strings.HasPrefix(target, ".."+string(filepath.Separator)) {
+				return fmt.Errorf("workspace symlink escapes root: %s -> %s", header.Name, header.Linkname)
+			}
+			err := os.MkdirAll(filepath.Dir(path), 0755)
+			if err != nil {
+				return err
+			}
+			err = os.Symlink(header.Linkname, path)
+			if err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			total += header.Size
+			if total > MaxWorkspaceBytes {
+				return fmt.Errorf("workspace exceeds %d bytes", MaxWorkspaceBytes)
+			}
+			err := os.MkdirAll(filepath.Dir(path), 0755)
+			if err != nil {
+				return err
+			}
+			f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.FileMode(header.Mode).Perm())
+			if err != nil {
+				return err
+			}
+			_, err = io.CopyN(f, tr, header.Size)
+			if err != nil {
+				_ = f.Close()
+				return err
+			}
+			err = f.Close()
+			if err != nil {
+				return err
+			}
+		default:
+		}
+	}
+}
+
+// fail if any existing component of name under dir is a symlink, so
+// that an earlier entry cannot redirect a later one outside dir
+func checkNoSymlinks(dir, name string) error {
+	path := dir
+	for _, part := range strings.Split(name, string(filepath.Separator)) {
+		if part == "." {
+			continue
+		}
+		path = filepath.Join(path, part)
+		info, err := os.Lstat(path)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			return fmt.Errorf("workspace path is through a symlink: %s", name)
+		}
+	}
+	return nil
+}
+
+// tar dir to a temp file and upload it, returning an id that can be
+// used as ExecPostRequest.Workspace.
+func UploadWorkspace(ctx context.Context, url, auth, dir string) (string, error) {
+	return NewFileClient(ClientOptions{Url: url, Auth: auth}).UploadWorkspace(ctx, dir)
+}
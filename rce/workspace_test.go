@@ -0,0 +1,104 @@
+package rce
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type tarEntry struct {
+	name string
+	link string // a symlink if set, else a regular file
+	data string
+}
+
+func makeTar(t *testing.T, entries []tarEntry) *bytes.Buffer {
+	var buf bytes.Buffer
+	gzw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gzw)
+	for _, e := range entries {
+		header := &tar.Header{Name: e.name, Mode: 0644, Typeflag: tar.TypeReg, Size: int64(len(e.data))}
+		if e.link != "" {
+			header = &tar.Header{Name: e.name, Mode: 0777, Typeflag: tar.TypeSymlink, Linkname: e.link}
+		}
+		err := tw.WriteHeader(header)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = tw.Write([]byte(e.data))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := tw.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = gzw.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &buf
+}
+
+func TestUntarWorkspace(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []tarEntry
+		err     string
+	}{
+		{"files", []tarEntry{{name: "a/b.txt", data: "b"}, {name: "..cache/c", data: "c"}}, ""},
+		{"relative symlink inside", []tarEntry{{name: "sub/x", data: "x"}, {name: "link", link: "sub/x"}}, ""},
+		{"dotdot symlink inside", []tarEntry{{name: "sub/x", data: "x"}, {name: "sub/y", link: "../sub/x"}}, ""},
+		{"dotdot path", []tarEntry{{name: "../x", data: "x"}}, "escapes root"},
+		{"absolute path", []tarEntry{{name: "/x", data: "x"}}, "escapes root"},
+		{"absolute symlink", []tarEntry{{name: "a", link: "/var/task"}, {name: "a/x", data: "x"}}, "symlink escapes root"},
+		{"dotdot symlink", []tarEntry{{name: "a", link: "../outside"}}, "symlink escapes root"},
+		{"nested dotdot symlink", []tarEntry{{name: "sub/a", link: "../../outside"}}, "symlink escapes root"},
+		{"write through symlink", []tarEntry{{name: "sub/x", data: "x"}, {name: "a", link: "sub"}, {name: "a/x", data: "y"}}, "through a symlink"},
+		{"overwrite symlink", []tarEntry{{name: "sub/x", data: "x"}, {name: "a", link: "sub/x"}, {name: "a", data: "y"}}, "through a symlink"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			root := t.TempDir()
+			dir := filepath.Join(root, "workspace")
+			err := os.Mkdir(dir, 0755)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = UntarWorkspace(makeTar(t, test.entries), dir)
+			if test.err == "" && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)) {
+				t.Fatalf("expected error containing %q, got: %v", test.err, err)
+			}
+			entries, err := os.ReadDir(root)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != 1 {
+				t.Fatalf("wrote outside the workspace: %v", entries)
+			}
+		})
+	}
+}
+
+func TestUntarWorkspaceContent(t *testing.T) {
+	dir := t.TempDir()
+	err := UntarWorkspace(makeTar(t, []tarEntry{{name: "sub/x", data: "hello"}, {name: "link", link: "sub/x"}}), dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "link"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "hello" {
+		t.Fatalf("got %q", data)
+	}
+}